@@ -0,0 +1,115 @@
+package zbaction
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/zeabur/action/proto"
+	"google.golang.org/protobuf/encoding/protojson"
+)
+
+// ActionStep runs another action as a step.
+//
+// The nested action runs with the isolated variables, which are its own
+// variables overridden by the inputs in With, and the runtime variables
+// of this action (see WithRuntimeVariables). The outputs of its steps are
+// mapped to the outputs of this step with Outputs, and its result is nested
+// in the result of this step (see StepResult.Action).
+//
+// The depth of the nested actions is limited by ExecutorOptions.MaxActionDepth.
+type ActionStep struct {
+	// Action is the action to run. Either Action or Path is required.
+	Action *Action
+	// Path is the protojson file of the action to run.
+	// A relative path is resolved from the working directory of this step.
+	Path string
+	// With is the inputs of the action, set as its variables.
+	With map[string]string
+	// Outputs maps the output names of this step to the values
+	// referring to the outputs of the action, such as `${out.push.image}`.
+	Outputs map[string]string
+}
+
+func (a ActionStep) Run(ctx context.Context, sc *StepContext) (CleanupFn, error) {
+	action, err := a.load(sc)
+	if err != nil {
+		return nil, err
+	}
+
+	variables := maps.Clone(action.Variables)
+	if variables == nil {
+		variables = make(map[string]string, len(a.With))
+	}
+	for key, value := range a.With {
+		variables[key] = sc.ExpandString(value)
+	}
+	action.Variables = variables
+
+	result, err := RunActionWithResult(ctx, action, sc.jobContext.actionContext.inheritOptions)
+	sc.actionResult = &result
+	if err != nil {
+		return nil, err
+	}
+
+	for name, value := range a.Outputs {
+		sc.SetThisOutput(name, os.Expand(value, func(s string) string {
+			// ${out.<step_id>.<key>}
+			if after, found := strings.CutPrefix(s, "out."); found {
+				if stepID, key, ok := strings.Cut(after, "."); ok {
+					if v, ok := result.GetOutput(stepID, key); ok {
+						return fmt.Sprintf("%v", v)
+					}
+				}
+			}
+
+			return ""
+		}))
+	}
+
+	return nil, nil
+}
+
+func (a ActionStep) load(sc *StepContext) (Action, error) {
+	if a.Action != nil {
+		return *a.Action, nil
+	}
+	if a.Path == "" {
+		return Action{}, errors.New("no action to run")
+	}
+
+	path := sc.ExpandString(a.Path)
+	if !filepath.IsAbs(path) {
+		wd, err := sc.WorkingDirectory()
+		if err != nil {
+			return Action{}, err
+		}
+		path = filepath.Join(wd, path)
+	}
+
+	return ReadAction(path)
+}
+
+// ReadAction reads an action from a protojson file.
+func ReadAction(file string) (Action, error) {
+	marshaled, err := os.ReadFile(file)
+	if err != nil {
+		return Action{}, fmt.Errorf("read file: %w", err)
+	}
+
+	p := &proto.Action{}
+	if err := protojson.Unmarshal(marshaled, p); err != nil {
+		return Action{}, fmt.Errorf("unmarshal action: %w", err)
+	}
+
+	action, err := ActionFromProto(p)
+	if err != nil {
+		return Action{}, fmt.Errorf("convert action: %w", err)
+	}
+
+	return action, nil
+}
@@ -0,0 +1,136 @@
+package zbaction_test
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	zbaction "github.com/zeabur/action"
+)
+
+func TestActionStep(t *testing.T) {
+	child := zbaction.Action{
+		ID:        "child",
+		Variables: map[string]string{"greeting": "Hello", "name": "nobody"},
+		Jobs: []zbaction.Job{
+			{
+				ID: "greet",
+				Steps: []zbaction.Step{
+					{
+						ID: "say",
+						RunnableStep: zbaction.CommandStep{
+							Command: []string{"echo", "${greeting}, ${name}${secret}"},
+						},
+					},
+				},
+			},
+		},
+	}
+
+	stdout := &bytes.Buffer{}
+
+	result, err := zbaction.RunActionWithResult(context.Background(), zbaction.Action{
+		ID:        "parent",
+		Variables: map[string]string{"who": "world", "secret": "!!!"},
+		Jobs: []zbaction.Job{
+			{
+				ID: "main",
+				Steps: []zbaction.Step{
+					{
+						ID: "call",
+						RunnableStep: zbaction.ActionStep{
+							Action:  &child,
+							With:    map[string]string{"name": "${who}"},
+							Outputs: map[string]string{"message": "${out.say.stdout}"},
+						},
+					},
+					{
+						RunnableStep: zbaction.CommandStep{
+							Command: []string{"printf", "%s", "${out.call.message}"},
+						},
+					},
+				},
+			},
+		},
+	}, zbaction.WithCustomStdout(stdout))
+
+	assert.NoError(t, err)
+	// the variables of the parent are not visible to the child.
+	assert.Equal(t, "Hello, world\nHello, world\n", stdout.String())
+
+	assert.Equal(t, "parent", result.ID)
+	assert.Len(t, result.Jobs, 1)
+	assert.Len(t, result.Jobs[0].Steps, 2)
+
+	call := result.Jobs[0].Steps[0]
+	assert.Equal(t, "call", call.ID)
+	if assert.NotNil(t, call.Action) {
+		assert.Equal(t, "child", call.Action.ID)
+		message, ok := call.Action.GetOutput("say", "stdout")
+		assert.True(t, ok)
+		assert.Equal(t, "Hello, world\n", message)
+	}
+}
+
+func TestActionStep_RuntimeVariables(t *testing.T) {
+	child := zbaction.Action{
+		Variables: map[string]string{"name": "nobody"},
+		Jobs: []zbaction.Job{
+			{
+				Steps: []zbaction.Step{
+					{
+						RunnableStep: zbaction.CommandStep{
+							Command: []string{"echo", "${REGISTRY}/${name}"},
+						},
+					},
+				},
+			},
+		},
+	}
+
+	stdout := &bytes.Buffer{}
+
+	err := zbaction.RunAction(context.Background(), zbaction.Action{
+		Jobs: []zbaction.Job{
+			{
+				Steps: []zbaction.Step{
+					{
+						RunnableStep: zbaction.ActionStep{
+							Action: &child,
+							// the inputs take precedence over the runtime variables
+							With: map[string]string{"name": "app"},
+						},
+					},
+				},
+			},
+		},
+	},
+		zbaction.WithRuntimeVariables(map[string]string{"REGISTRY": "registry.example.com", "name": "runtime"}),
+		zbaction.WithCustomStdout(stdout),
+	)
+
+	assert.NoError(t, err)
+	assert.Equal(t, "registry.example.com/app\n", stdout.String())
+}
+
+func TestActionStep_Recursion(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "action.json")
+	err := os.WriteFile(file, []byte(`{
+		"id": "recursive",
+		"jobs": [{"steps": [{"action": {"path": "`+file+`"}}]}]
+	}`), 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	action, err := zbaction.ReadAction(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = zbaction.RunAction(context.Background(), action, zbaction.WithMaxActionDepth(3))
+	assert.ErrorAs(t, err, &zbaction.ErrActionDepthExceeded{})
+}
@@ -0,0 +1,125 @@
+package zbaction
+
+import (
+	"context"
+	"log/slog"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// AnnotationLevel is the severity of an annotation.
+type AnnotationLevel string
+
+const (
+	AnnotationLevelNotice  AnnotationLevel = "notice"
+	AnnotationLevelWarning AnnotationLevel = "warning"
+	AnnotationLevelError   AnnotationLevel = "error"
+)
+
+// Annotation is a message a step raises about its result,
+// such as a deprecated option in a configuration file.
+type Annotation struct {
+	// Level is the severity. By default, it is AnnotationLevelNotice.
+	Level   AnnotationLevel
+	Message string
+	// File is the path of the file the annotation refers to,
+	// relative to the job root. Empty means no file.
+	File string
+	// Line is the line in File, starting from 1. 0 means the whole file.
+	Line int
+}
+
+// String formats the annotation as `<level>: <file>:<line>: <message>`.
+func (a Annotation) String() string {
+	var sb strings.Builder
+
+	sb.WriteString(string(a.Level))
+	sb.WriteString(": ")
+	if a.File != "" {
+		sb.WriteString(a.File)
+		if a.Line > 0 {
+			sb.WriteString(":" + strconv.Itoa(a.Line))
+		}
+		sb.WriteString(": ")
+	}
+	sb.WriteString(a.Message)
+
+	return sb.String()
+}
+
+func (l AnnotationLevel) slogLevel() slog.Level {
+	switch l {
+	case AnnotationLevelError:
+		return slog.LevelError
+	case AnnotationLevelWarning:
+		return slog.LevelWarn
+	default:
+		return slog.LevelInfo
+	}
+}
+
+// stepReport collects the annotations and the summary of a step.
+// The nested steps share the report of the step they are nested in.
+type stepReport struct {
+	annotations []Annotation
+	summary     strings.Builder
+	mu          sync.Mutex
+}
+
+// Annotate adds an annotation to this step.
+//
+// The annotation is logged, and collected in StepResult.Annotations.
+func (sc *StepContext) Annotate(annotation Annotation) {
+	if annotation.Level == "" {
+		annotation.Level = AnnotationLevelNotice
+	}
+
+	attrs := []any{slog.String("step", sc.id)}
+	if annotation.File != "" {
+		attrs = append(attrs, slog.String("file", annotation.File))
+	}
+	if annotation.Line > 0 {
+		attrs = append(attrs, slog.Int("line", annotation.Line))
+	}
+	slog.Log(context.Background(), annotation.Level.slogLevel(), annotation.Message, attrs...)
+
+	if sc.report == nil {
+		return
+	}
+
+	sc.report.mu.Lock()
+	defer sc.report.mu.Unlock()
+
+	sc.report.annotations = append(sc.report.annotations, annotation)
+}
+
+// AppendSummary appends Markdown to the summary of this step,
+// which explains the result of the step, such as a table of the built images.
+//
+// The summary is collected in StepResult.Summary.
+func (sc *StepContext) AppendSummary(markdown string) {
+	if sc.report == nil {
+		return
+	}
+
+	sc.report.mu.Lock()
+	defer sc.report.mu.Unlock()
+
+	sc.report.summary.WriteString(markdown)
+}
+
+// snapshot copies the annotations and the summary collected so far.
+func (r *stepReport) snapshot() ([]Annotation, string) {
+	if r == nil {
+		return nil, ""
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if len(r.annotations) == 0 {
+		return nil, r.summary.String()
+	}
+	return append([]Annotation(nil), r.annotations...), r.summary.String()
+}
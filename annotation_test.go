@@ -0,0 +1,83 @@
+package zbaction_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	zbaction "github.com/zeabur/action"
+)
+
+type annotateStep struct {
+	annotation zbaction.Annotation
+	summary    string
+}
+
+func (s annotateStep) Run(_ context.Context, sc *zbaction.StepContext) (zbaction.CleanupFn, error) {
+	sc.Annotate(s.annotation)
+	sc.AppendSummary(s.summary)
+	return nil, nil
+}
+
+func TestStepContext_Annotate(t *testing.T) {
+	r := zbaction.NewProcedureStepResolverWithParent(zbaction.GlobalProcedureResolver())
+	r.Register("test/lint", func(zbaction.ProcStepArgs) (zbaction.ProcedureStep, error) {
+		return annotateStep{
+			annotation: zbaction.Annotation{Level: zbaction.AnnotationLevelWarning, Message: "unused variable", File: "main.go", Line: 12},
+			summary:    "| file | problems |\n| main.go | 1 |\n",
+		}, nil
+	})
+	r.Register("test/note", func(zbaction.ProcStepArgs) (zbaction.ProcedureStep, error) {
+		return annotateStep{
+			annotation: zbaction.Annotation{Message: "cache hit"},
+			summary:    "Cached.\n",
+		}, nil
+	})
+	zbaction.RegisterCompositeProcedure(r, zbaction.CompositeProcedure{
+		Name: "test/check",
+		Steps: []zbaction.Step{
+			{ID: "note", RunnableStep: zbaction.ProcStep{Uses: "test/note"}},
+			{ID: "lint", RunnableStep: zbaction.ProcStep{Uses: "test/lint"}},
+		},
+	})
+
+	result, err := zbaction.RunActionWithResult(context.Background(), zbaction.Action{
+		Jobs: []zbaction.Job{
+			{
+				ID: "main",
+				Steps: []zbaction.Step{
+					{ID: "plain", RunnableStep: zbaction.CommandStep{Command: []string{"true"}}},
+					{ID: "check", RunnableStep: zbaction.ProcStep{Uses: "test/check"}},
+				},
+			},
+		},
+	}, zbaction.WithProcedureResolver(r))
+
+	assert.NoError(t, err)
+
+	steps := result.Jobs[0].Steps
+	assert.Len(t, steps, 2)
+	assert.Empty(t, steps[0].Annotations)
+	assert.Empty(t, steps[0].Summary)
+
+	// the nested steps are reported by the step they are nested in
+	expected := []zbaction.Annotation{
+		{Level: zbaction.AnnotationLevelNotice, Message: "cache hit"},
+		{Level: zbaction.AnnotationLevelWarning, Message: "unused variable", File: "main.go", Line: 12},
+	}
+	assert.Equal(t, expected, steps[1].Annotations)
+	assert.Equal(t, "Cached.\n| file | problems |\n| main.go | 1 |\n", steps[1].Summary)
+	assert.Equal(t, expected, result.Annotations())
+}
+
+func TestAnnotation_String(t *testing.T) {
+	assert.Equal(t, "warning: main.go:12: unused variable", zbaction.Annotation{
+		Level: zbaction.AnnotationLevelWarning, Message: "unused variable", File: "main.go", Line: 12,
+	}.String())
+	assert.Equal(t, "error: go.mod: invalid", zbaction.Annotation{
+		Level: zbaction.AnnotationLevelError, Message: "invalid", File: "go.mod",
+	}.String())
+	assert.Equal(t, "notice: done", zbaction.Annotation{
+		Level: zbaction.AnnotationLevelNotice, Message: "done",
+	}.String())
+}
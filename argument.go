@@ -46,7 +46,20 @@ func NewArgumentBool(value string) Argument[bool] {
 	return mappableArgContainer[bool]{
 		argContainer: argContainer{raw: value},
 		mapper: func(s string) bool {
-			return s == "true" || s == "1" || s == "True" || s == "TRUE"
+			b, _ := parseBool(s)
+			return b
 		},
 	}
 }
+
+// parseBool parses the boolean values accepted by NewArgumentBool.
+func parseBool(s string) (value bool, ok bool) {
+	switch s {
+	case "true", "1", "True", "TRUE":
+		return true, true
+	case "false", "0", "False", "FALSE", "":
+		return false, true
+	}
+
+	return false, false
+}
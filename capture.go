@@ -0,0 +1,206 @@
+package zbaction
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+)
+
+// DefaultOutputLimit is the default number of bytes of a stream
+// kept in memory as the step output.
+const DefaultOutputLimit = 1 << 20 // 1 MiB
+
+type contextWriter struct {
+	io.Writer
+
+	variable string
+	sc       *StepContext
+	capture  *outputCapture
+}
+
+// NewContextWriter creates a writer which writes to target,
+// and saves what it wrote as the output `variable` of this step on Close.
+//
+// At most the output limit of the action is kept in memory. If the stream
+// exceeds it, the whole stream is spilled to a log file, and the output
+// keeps only the head and the tail of the stream with a truncation marker.
+// The path of the log file is saved as the output `<variable>File`.
+// The log file is kept in the log directory of the action if specified
+// (see WithLogDirectory); otherwise, it is kept in a temporary directory
+// of the job until the job cleans up, so the later steps can read it.
+//
+// The target is usually sc.Stdout() or sc.Stderr(), which format the stream
+// with the log options of the action, while the output always keeps the raw stream.
+func NewContextWriter(sc *StepContext, variable string, target io.Writer) io.WriteCloser {
+	limit := sc.jobContext.actionContext.outputLimit
+	if limit <= 0 {
+		limit = DefaultOutputLimit
+	}
+
+	capture := &outputCapture{
+		limit: limit,
+		createFile: func() (*os.File, error) {
+			logDirectory, err := sc.jobContext.GetLogDirectory()
+			if err != nil {
+				return nil, err
+			}
+
+			// the log directory may be shared by the jobs and the nested actions
+			name := sc.jobContext.ID() + "-" + sc.ID() + "-" + variable
+			pattern := strings.ReplaceAll(name, string(os.PathSeparator), "_") + "-*.log"
+			return os.CreateTemp(logDirectory, pattern)
+		},
+	}
+
+	return &contextWriter{
+		Writer:   io.MultiWriter(capture, target),
+		sc:       sc,
+		variable: variable,
+		capture:  capture,
+	}
+}
+
+func (cw *contextWriter) Close() error {
+	cw.sc.SetThisOutput(cw.variable, cw.capture.String())
+	cw.sc.SetThisOutput(cw.variable+"File", cw.capture.Path())
+	cw.sc.SetThisOutput(cw.variable+"Truncated", cw.capture.Truncated())
+
+	return cw.capture.Close()
+}
+
+// outputCapture keeps the stream in memory until it exceeds limit.
+//
+// After that, the stream is written to the file created by createFile,
+// and only the first and the last limit/2 bytes are kept in memory.
+type outputCapture struct {
+	limit      int
+	createFile func() (*os.File, error)
+
+	buf   []byte
+	head  []byte
+	tail  []byte
+	total int64
+	file  *os.File
+	// fileErr is the error when creating or writing the spilled file.
+	// We keep capturing the head and the tail in this case.
+	fileErr error
+
+	mu sync.Mutex
+}
+
+func (c *outputCapture) Write(p []byte) (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.head == nil && len(c.buf)+len(p) <= c.limit {
+		c.buf = append(c.buf, p...)
+		c.total += int64(len(p))
+		return len(p), nil
+	}
+
+	if c.head == nil {
+		c.spill()
+	}
+
+	if c.file != nil && c.fileErr == nil {
+		if _, err := c.file.Write(p); err != nil {
+			c.fileErr = err
+		}
+	}
+
+	c.total += int64(len(p))
+
+	if remaining := c.headLimit() - len(c.head); remaining > 0 {
+		c.head = append(c.head, p[:min(remaining, len(p))]...)
+	}
+
+	tailLimit := c.tailLimit()
+	c.tail = append(c.tail, p...)
+	if len(c.tail) > tailLimit*2 {
+		c.tail = append(c.tail[:0], c.tail[len(c.tail)-tailLimit:]...)
+	}
+
+	return len(p), nil
+}
+
+// spill moves the in-memory buffer to the log file.
+func (c *outputCapture) spill() {
+	headLimit := c.headLimit()
+
+	c.head = append(make([]byte, 0, headLimit), c.buf[:min(headLimit, len(c.buf))]...)
+	c.tail = append(c.tail, c.buf[max(len(c.buf)-c.tailLimit(), 0):]...)
+
+	c.file, c.fileErr = c.createFile()
+	if c.fileErr == nil {
+		_, c.fileErr = c.file.Write(c.buf)
+	}
+
+	c.buf = nil
+}
+
+func (c *outputCapture) headLimit() int {
+	return c.limit / 2
+}
+
+func (c *outputCapture) tailLimit() int {
+	return c.limit - c.headLimit()
+}
+
+// String returns the captured stream, with the middle part
+// replaced with a truncation marker if it exceeds the limit.
+func (c *outputCapture) String() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.head == nil {
+		return string(c.buf)
+	}
+
+	tail := c.tail[max(len(c.tail)-c.tailLimit(), 0):]
+	truncated := c.total - int64(len(c.head)) - int64(len(tail))
+
+	sb := strings.Builder{}
+	sb.Write(c.head)
+	if c.file != nil && c.fileErr == nil {
+		sb.WriteString(fmt.Sprintf("\n... [%d bytes truncated, see %s] ...\n", truncated, c.file.Name()))
+	} else {
+		sb.WriteString(fmt.Sprintf("\n... [%d bytes truncated] ...\n", truncated))
+	}
+	sb.Write(tail)
+
+	return sb.String()
+}
+
+// Path returns the path of the log file of the stream.
+// It is empty if the stream has not been spilled to the disk.
+func (c *outputCapture) Path() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.file == nil || c.fileErr != nil {
+		return ""
+	}
+
+	return c.file.Name()
+}
+
+// Truncated returns whether the captured output is truncated.
+func (c *outputCapture) Truncated() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.head != nil
+}
+
+func (c *outputCapture) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.file == nil {
+		return nil
+	}
+
+	return c.file.Close()
+}
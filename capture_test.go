@@ -0,0 +1,52 @@
+package zbaction
+
+import (
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestOutputCapture(t *testing.T, limit int) *outputCapture {
+	dir := t.TempDir()
+
+	return &outputCapture{
+		limit: limit,
+		createFile: func() (*os.File, error) {
+			return os.CreateTemp(dir, "stdout-*.log")
+		},
+	}
+}
+
+func TestOutputCapture_InMemory(t *testing.T) {
+	c := newTestOutputCapture(t, 16)
+
+	_, _ = c.Write([]byte("hello "))
+	_, _ = c.Write([]byte("world"))
+
+	assert.Equal(t, "hello world", c.String())
+	assert.False(t, c.Truncated())
+	assert.Empty(t, c.Path())
+	assert.NoError(t, c.Close())
+}
+
+func TestOutputCapture_Spill(t *testing.T) {
+	c := newTestOutputCapture(t, 8)
+
+	_, _ = c.Write([]byte("0123"))
+	_, _ = c.Write([]byte("456789"))
+	_, _ = c.Write([]byte("abcdef"))
+	assert.NoError(t, c.Close())
+
+	assert.True(t, c.Truncated())
+	assert.NotEmpty(t, c.Path())
+
+	content, err := os.ReadFile(c.Path())
+	assert.NoError(t, err)
+	assert.Equal(t, "0123456789abcdef", string(content))
+
+	output := c.String()
+	assert.True(t, strings.HasPrefix(output, "0123\n... [8 bytes truncated"), output)
+	assert.True(t, strings.HasSuffix(output, "] ...\ncdef"), output)
+}
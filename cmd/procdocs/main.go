@@ -0,0 +1,35 @@
+// Command procdocs generates the reference documentation of the builtin procedures.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	zbaction "github.com/zeabur/action"
+	"github.com/zeabur/action/procdocs"
+	_ "github.com/zeabur/action/procedures"
+	_ "github.com/zeabur/action/procedures/artifact"
+)
+
+func main() {
+	format := flag.String("format", "markdown", "the format of the documentation (markdown or json)")
+	flag.Parse()
+
+	resolver := zbaction.GlobalProcedureResolver()
+
+	var err error
+	switch *format {
+	case "markdown":
+		err = procdocs.RenderMarkdown(os.Stdout, resolver)
+	case "json":
+		err = procdocs.RenderJSON(os.Stdout, resolver)
+	default:
+		err = fmt.Errorf("unknown format: %s", *format)
+	}
+
+	if err != nil {
+		_, _ = fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
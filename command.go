@@ -1,67 +1,171 @@
 package zbaction
 
 import (
-	"bytes"
 	"context"
-	"io"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
 	"os/exec"
+	"slices"
+	"strings"
+	"syscall"
+	"time"
 
 	"github.com/samber/lo"
 )
 
 type CommandStep struct {
 	Command []string
+	// Shell is the shell to run the command with, for example
+	// `[]string{"bash", "-c"}`. It overrides the default shell.
+	//
+	// With a shell, Command must be a single script, which is
+	// passed to the shell as the last argument.
+	Shell []string
+	// AcceptedExitCodes are the non-zero exit codes considered successful,
+	// for example `[]int{1}` for `grep` which exits with 1 if nothing matched.
+	//
+	// The exit code 0 is always accepted.
+	AcceptedExitCodes []int
+	// Input is written to the stdin of the command, expanded like Command.
+	// For example, `${out.<step_id>.stdout}` feeds the stdout of another step.
+	//
+	// The expanded input is never logged or saved to the outputs,
+	// so it is safe to pass secrets like `docker login --password-stdin`.
+	Input string
 }
 
 func (c CommandStep) Run(ctx context.Context, sc *StepContext) (CleanupFn, error) {
-	stdout := NewContextWriter(sc, "stdout", sc.Stdout())
-	stderr := NewContextWriter(sc, "stderr", sc.Stderr())
+	defaults := sc.Defaults()
 
 	// expand command
 	expandedCommand := lo.Map(c.Command, func(s string, _ int) string {
 		return sc.ExpandString(s)
 	})
 
+	if len(expandedCommand) == 0 {
+		return nil, errors.New("no command specified")
+	}
+
+	shell := c.Shell
+	if len(shell) == 0 {
+		shell = defaults.Shell
+	}
+	if len(shell) > 0 {
+		if len(expandedCommand) > 1 {
+			return nil, errors.New("a command run with a shell must be a single script")
+		}
+
+		expandedCommand = append(lo.Map(shell, func(s string, _ int) string {
+			return sc.ExpandString(s)
+		}), expandedCommand...)
+	}
+
+	wd, err := sc.WorkingDirectory()
+	if err != nil {
+		return nil, fmt.Errorf("resolve working directory: %w", err)
+	}
+
+	env := ListEnvironmentVariables(sc.VariableContainer())
+	for key, value := range defaults.Environment {
+		if _, ok := env[key]; !ok {
+			env[key] = sc.ExpandString(value)
+		}
+	}
+
 	cmd := exec.CommandContext(ctx, expandedCommand[0], expandedCommand[1:]...)
-	cmd.Dir = sc.Root()
+	cmd.Dir = wd
+	cmd.Env = env.ToList()
+	if c.Input != "" {
+		cmd.Stdin = strings.NewReader(sc.ExpandString(c.Input))
+	}
+	processGroup := newProcessGroup(cmd, sc.jobContext.actionContext.killGracePeriod)
+
+	limiter, err := newResourceLimiter(cmd, sc.ResourceLimits(), sc.jobContext.actionContext.bestEffortLimits)
+	if err != nil {
+		return nil, fmt.Errorf("set up resource limits: %w", err)
+	}
+	defer limiter.Close()
+
+	// the writers are created after the validation,
+	// so they are always closed to save the outputs.
+	stdout := NewContextWriter(sc, "stdout", sc.Stdout())
+	stderr := NewContextWriter(sc, "stderr", sc.Stderr())
 	cmd.Stdout = stdout
 	cmd.Stderr = stderr
-	cmd.Env = ListEnvironmentVariables(sc.VariableContainer()).ToList()
 
-	if err := cmd.Run(); err != nil {
-		return nil, err
+	startedAt := time.Now()
+	runErr := cmd.Start()
+	if runErr == nil {
+		limiter.Started()
+
+		runErr = cmd.Wait()
+		if errors.Is(runErr, exec.ErrWaitDelay) && cmd.ProcessState.Success() {
+			// the command succeeded, but the processes it left behind
+			// held the pipes until WaitDelay, which is not a failure.
+			slog.Warn("Command exited, but its descendants kept the output open",
+				slog.String("step", sc.ID()))
+			runErr = nil
+		}
 	}
+	duration := time.Since(startedAt)
+
+	// wait for the descendants to exit if the command was cancelled,
+	// so they will not keep using the job root after this step.
+	processGroup.Wait()
 
 	// save to variable
 	_ = stdout.Close()
 	_ = stderr.Close()
 
-	return nil, nil
-}
+	exitCode, signal := exitStatus(cmd.ProcessState)
+	exceededResource, exceeded := limiter.Exceeded(cmd.ProcessState)
+	sc.SetThisOutput("exitCode", exitCode)
+	sc.SetThisOutput("signal", signal)
+	sc.SetThisOutput("duration", duration)
+	sc.SetThisOutput("limitExceeded", exceededResource)
 
-type contextWriter struct {
-	io.Writer
+	if runErr != nil {
+		if ctx.Err() != nil {
+			return nil, fmt.Errorf("command cancelled (%s): %w", runErr, ctx.Err())
+		}
 
-	variable    string
-	sc          *StepContext
-	bytesBuffer *bytes.Buffer
-}
+		if exceeded {
+			return nil, NewErrResourceLimitExceeded(exceededResource, runErr)
+		}
 
-func NewContextWriter(sc *StepContext, variable string, target io.Writer) io.WriteCloser {
-	buf := &bytes.Buffer{}
-	mw := io.MultiWriter(buf, target)
+		var exitErr *exec.ExitError
+		if !errors.As(runErr, &exitErr) {
+			return nil, fmt.Errorf("run command: %w", runErr)
+		}
 
-	return &contextWriter{
-		Writer:      mw,
-		sc:          sc,
-		variable:    variable,
-		bytesBuffer: buf,
+		if slices.Contains(c.AcceptedExitCodes, exitCode) {
+			return nil, nil
+		}
+
+		if signal != "" {
+			return nil, fmt.Errorf("command terminated by signal %s: %w", signal, runErr)
+		}
+		return nil, fmt.Errorf("command exited with code %d: %w", exitCode, runErr)
 	}
+
+	return nil, nil
 }
 
-func (cw *contextWriter) Close() error {
-	cw.sc.SetThisOutput(cw.variable, cw.bytesBuffer.String())
-	return nil
+// exitStatus extracts the exit code and the terminating signal from the process state.
+//
+// The exit code is -1 if the process has not exited or was terminated by a signal.
+func exitStatus(state *os.ProcessState) (exitCode int, signal string) {
+	if state == nil {
+		return -1, ""
+	}
+
+	if status, ok := state.Sys().(syscall.WaitStatus); ok && status.Signaled() {
+		return state.ExitCode(), status.Signal().String()
+	}
+
+	return state.ExitCode(), ""
 }
 
 var _ RunnableStep = (*CommandStep)(nil)
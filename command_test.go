@@ -0,0 +1,511 @@
+package zbaction_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"math"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	zbaction "github.com/zeabur/action"
+)
+
+func TestCommandStep_WorkingDirectory(t *testing.T) {
+	stdout := &bytes.Buffer{}
+
+	err := zbaction.RunAction(context.Background(), zbaction.Action{
+		Jobs: []zbaction.Job{
+			{
+				Steps: []zbaction.Step{
+					{
+						RunnableStep: zbaction.CommandStep{
+							Command: []string{"mkdir", "-p", "services/api"},
+						},
+					},
+					{
+						WorkingDirectory: "services/api",
+						RunnableStep: zbaction.CommandStep{
+							Command: []string{"pwd"},
+						},
+					},
+				},
+			},
+		},
+	}, zbaction.WithCustomStdout(stdout))
+
+	assert.NoError(t, err)
+	assert.True(t, strings.HasSuffix(stdout.String(), "/services/api\n"), stdout.String())
+}
+
+func TestCommandStep_WorkingDirectoryOutsideRoot(t *testing.T) {
+	err := zbaction.RunAction(context.Background(), zbaction.Action{
+		Jobs: []zbaction.Job{
+			{
+				Steps: []zbaction.Step{
+					{
+						WorkingDirectory: "../",
+						RunnableStep: zbaction.CommandStep{
+							Command: []string{"true"},
+						},
+					},
+				},
+			},
+		},
+	})
+
+	assert.ErrorAs(t, err, &zbaction.ErrPathOutsideRoot{})
+}
+
+func TestCommandStep_Defaults(t *testing.T) {
+	stdout := &bytes.Buffer{}
+
+	err := zbaction.RunAction(context.Background(), zbaction.Action{
+		Defaults: zbaction.Defaults{
+			Shell: []string{"sh", "-c"},
+			Environment: map[string]string{
+				"GREETING": "hello",
+				"TARGET":   "action",
+			},
+		},
+		Jobs: []zbaction.Job{
+			{
+				Defaults: zbaction.Defaults{
+					Environment: map[string]string{
+						"TARGET": "job",
+					},
+				},
+				Steps: []zbaction.Step{
+					{
+						RunnableStep: zbaction.CommandStep{
+							Command: []string{"printenv GREETING TARGET STEP"},
+						},
+						Variables: map[string]string{
+							"STEP": "step",
+						},
+					},
+				},
+			},
+		},
+	}, zbaction.WithCustomStdout(stdout))
+
+	assert.NoError(t, err)
+	assert.Equal(t, "hello\njob\nstep\n", stdout.String())
+}
+
+func TestCommandStep_Shell(t *testing.T) {
+	stdout := &bytes.Buffer{}
+
+	err := zbaction.RunAction(context.Background(), zbaction.Action{
+		Variables: map[string]string{"NAME": "a  b"},
+		Jobs: []zbaction.Job{
+			{
+				Steps: []zbaction.Step{
+					{
+						RunnableStep: zbaction.CommandStep{
+							Shell:   []string{"sh", "-c"},
+							Command: []string{`echo "$NAME" $(echo x)`},
+						},
+					},
+				},
+			},
+		},
+	}, zbaction.WithCustomStdout(stdout))
+
+	assert.NoError(t, err)
+	assert.Equal(t, "a  b x\n", stdout.String())
+
+	err = zbaction.RunAction(context.Background(), zbaction.Action{
+		Jobs: []zbaction.Job{
+			{
+				Steps: []zbaction.Step{
+					{
+						RunnableStep: zbaction.CommandStep{
+							Shell:   []string{"sh", "-c"},
+							Command: []string{"echo", "a  b", "$(x)"},
+						},
+					},
+				},
+			},
+		},
+	})
+
+	assert.ErrorContains(t, err, "single script")
+}
+
+func TestCommandStep_ExitCode(t *testing.T) {
+	stdout := &bytes.Buffer{}
+	stderr := &bytes.Buffer{}
+
+	err := zbaction.RunAction(context.Background(), zbaction.Action{
+		Jobs: []zbaction.Job{
+			{
+				Steps: []zbaction.Step{
+					{
+						ID: "fail",
+						RunnableStep: zbaction.CommandStep{
+							Command: []string{"sh", "-c", "echo failed >&2; exit 3"},
+						},
+					},
+				},
+			},
+		},
+	}, zbaction.WithCustomStdout(stdout), zbaction.WithCustomStderr(stderr))
+
+	var exitErr *exec.ExitError
+	assert.ErrorAs(t, err, &exitErr)
+	assert.Equal(t, 3, exitErr.ExitCode())
+	assert.Equal(t, "failed\n", stderr.String())
+}
+
+func TestCommandStep_AcceptedExitCodes(t *testing.T) {
+	stdout := &bytes.Buffer{}
+
+	err := zbaction.RunAction(context.Background(), zbaction.Action{
+		Jobs: []zbaction.Job{
+			{
+				Steps: []zbaction.Step{
+					{
+						ID: "grep",
+						RunnableStep: zbaction.CommandStep{
+							Command:           []string{"sh", "-c", "echo not matched >&2; exit 1"},
+							AcceptedExitCodes: []int{1},
+						},
+					},
+					{
+						RunnableStep: zbaction.CommandStep{
+							Command: []string{"echo", "${out.grep.exitCode}|${out.grep.signal}|${out.grep.stderr}"},
+						},
+					},
+				},
+			},
+		},
+	}, zbaction.WithCustomStdout(stdout))
+
+	assert.NoError(t, err)
+	assert.Equal(t, "1||not matched\n\n", stdout.String())
+}
+
+func TestCommandStep_CancelProcessGroup(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+	defer cancel()
+
+	startedAt := time.Now()
+	err := zbaction.RunAction(ctx, zbaction.Action{
+		Jobs: []zbaction.Job{
+			{
+				Steps: []zbaction.Step{
+					{
+						RunnableStep: zbaction.CommandStep{
+							// the background sleep ignores SIGTERM and holds stdout.
+							Command: []string{"sh", "-c", "trap '' TERM; sleep 30 & wait"},
+						},
+					},
+				},
+			},
+		},
+	}, zbaction.WithKillGracePeriod(200*time.Millisecond))
+
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.Less(t, time.Since(startedAt), 5*time.Second)
+}
+
+func TestCommandStep_DescendantHoldsOutput(t *testing.T) {
+	stdout := &bytes.Buffer{}
+
+	err := zbaction.RunAction(context.Background(), zbaction.Action{
+		Jobs: []zbaction.Job{
+			{
+				Steps: []zbaction.Step{
+					{
+						RunnableStep: zbaction.CommandStep{
+							// the background sleep holds stdout after sh exits.
+							Command: []string{"sh", "-c", "sleep 10 & echo done"},
+						},
+					},
+				},
+			},
+		},
+	}, zbaction.WithCustomStdout(stdout), zbaction.WithKillGracePeriod(100*time.Millisecond))
+
+	assert.NoError(t, err)
+	assert.Equal(t, "done\n", stdout.String())
+}
+
+func TestCommandStep_ResourceLimits(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("resource limits are only supported on Linux")
+	}
+
+	err := zbaction.RunAction(context.Background(), zbaction.Action{
+		Jobs: []zbaction.Job{
+			{
+				Limits: zbaction.ResourceLimits{
+					MaxCPUTime: 10 * time.Second,
+				},
+				Steps: []zbaction.Step{
+					{
+						Limits: zbaction.ResourceLimits{
+							MaxCPUTime: time.Second,
+						},
+						RunnableStep: zbaction.CommandStep{
+							Command: []string{"sh", "-c", "while :; do :; done"},
+						},
+					},
+				},
+			},
+		},
+	})
+
+	var limitErr zbaction.ErrResourceLimitExceeded
+	assert.ErrorAs(t, err, &limitErr)
+	assert.Equal(t, zbaction.ResourceCPUTime, limitErr.Resource)
+}
+
+func TestCommandStep_ResourceLimitsBeforeExec(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("resource limits are only supported on Linux")
+	}
+
+	stdout := &bytes.Buffer{}
+
+	err := zbaction.RunAction(context.Background(), zbaction.Action{
+		Jobs: []zbaction.Job{
+			{
+				Steps: []zbaction.Step{
+					{
+						Limits: zbaction.ResourceLimits{
+							MaxOpenFiles: 64,
+						},
+						RunnableStep: zbaction.CommandStep{
+							// the limit is in effect as soon as the command starts
+							Command: []string{"sh", "-c", "ulimit -n"},
+						},
+					},
+				},
+			},
+		},
+	}, zbaction.WithCustomStdout(stdout))
+
+	assert.NoError(t, err)
+	assert.Equal(t, "64\n", stdout.String())
+}
+
+// runWithLimits runs the command with the resource limits.
+func runWithLimits(limits zbaction.ResourceLimits, command string, options ...zbaction.ExecutorOptionsFn) error {
+	return zbaction.RunAction(context.Background(), zbaction.Action{
+		Jobs: []zbaction.Job{
+			{
+				Steps: []zbaction.Step{
+					{
+						Limits:       limits,
+						RunnableStep: zbaction.CommandStep{Command: []string{"sh", "-c", command}},
+					},
+				},
+			},
+		},
+	}, append([]zbaction.ExecutorOptionsFn{zbaction.WithCustomStdout(&bytes.Buffer{})}, options...)...)
+}
+
+// skipWithoutCgroup skips the test if the cgroup v2 is not delegated,
+// which is required by the memory and process limits.
+func skipWithoutCgroup(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("resource limits are only supported on Linux")
+	}
+
+	err := runWithLimits(zbaction.ResourceLimits{MaxMemory: 1 << 30, MaxProcesses: 1024}, "true")
+	if errors.As(err, &zbaction.ErrResourceLimitUnsupported{}) {
+		t.Skipf("cgroup v2 is not delegated: %s", err)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCommandStep_MemoryLimit(t *testing.T) {
+	skipWithoutCgroup(t)
+
+	err := runWithLimits(zbaction.ResourceLimits{MaxMemory: 16 << 20},
+		`x=$(head -c 67108864 /dev/zero | tr '\0' a); echo ${#x}`)
+
+	var limitErr zbaction.ErrResourceLimitExceeded
+	assert.ErrorAs(t, err, &limitErr)
+	assert.Equal(t, zbaction.ResourceMemory, limitErr.Resource)
+}
+
+func TestCommandStep_ProcessLimit(t *testing.T) {
+	skipWithoutCgroup(t)
+
+	// the script exits with 1 in any case, and the error
+	// tells whether it has reached the process limit.
+	err := runWithLimits(zbaction.ResourceLimits{MaxProcesses: 4},
+		"for i in 1 2 3 4 5 6 7 8; do sleep 1 & done; wait; exit 1")
+
+	var limitErr zbaction.ErrResourceLimitExceeded
+	assert.ErrorAs(t, err, &limitErr)
+	assert.Equal(t, zbaction.ResourceProcesses, limitErr.Resource)
+
+	assert.NoError(t, runWithLimits(zbaction.ResourceLimits{MaxProcesses: 16},
+		"for i in 1 2 3 4 5 6 7 8; do sleep 1 & done; wait"))
+}
+
+func TestCommandStep_ResourceLimitsUnsupported(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("resource limits are only supported on Linux")
+	}
+
+	var rlimit syscall.Rlimit
+	if err := syscall.Getrlimit(syscall.RLIMIT_NOFILE, &rlimit); err != nil {
+		t.Fatal(err)
+	}
+	if rlimit.Max < math.MaxInt64 {
+		// a limit above the hard limit is not lowered silently
+		limits := zbaction.ResourceLimits{MaxOpenFiles: int64(rlimit.Max) + 1}
+
+		var unsupportedErr zbaction.ErrResourceLimitUnsupported
+		assert.ErrorAs(t, runWithLimits(limits, "true"), &unsupportedErr)
+		assert.Equal(t, zbaction.ResourceOpenFiles, unsupportedErr.Resource)
+		assert.NoError(t, runWithLimits(limits, "true", zbaction.WithBestEffortResourceLimits()))
+	}
+
+	limits := zbaction.ResourceLimits{MaxProcesses: 1024}
+	err := runWithLimits(limits, "true")
+	if err == nil {
+		t.Skip("cgroup v2 is delegated")
+	}
+
+	var unsupportedErr zbaction.ErrResourceLimitUnsupported
+	assert.ErrorAs(t, err, &unsupportedErr)
+	assert.Equal(t, zbaction.ResourceProcesses, unsupportedErr.Resource)
+	assert.NoError(t, runWithLimits(limits, "true", zbaction.WithBestEffortResourceLimits()))
+}
+
+func TestCommandStep_InactivityTimeout(t *testing.T) {
+	err := zbaction.RunAction(context.Background(), zbaction.Action{
+		Jobs: []zbaction.Job{
+			{
+				Steps: []zbaction.Step{
+					{
+						InactivityTimeout: 300 * time.Millisecond,
+						RunnableStep: zbaction.CommandStep{
+							Command: []string{"sh", "-c", "echo 1; sleep 0.1; echo 2; sleep 0.1; echo 3"},
+						},
+					},
+					{
+						InactivityTimeout: 300 * time.Millisecond,
+						RunnableStep: zbaction.CommandStep{
+							Command: []string{"sleep", "10"},
+						},
+					},
+				},
+			},
+		},
+	}, zbaction.WithCustomStdout(&bytes.Buffer{}))
+
+	var noOutputErr zbaction.ErrNoOutput
+	assert.ErrorAs(t, err, &noOutputErr)
+	assert.Equal(t, 300*time.Millisecond, noOutputErr.Timeout)
+	assert.NotErrorIs(t, err, context.Canceled)
+}
+
+func TestCommandStep_Input(t *testing.T) {
+	stdout := &bytes.Buffer{}
+
+	err := zbaction.RunAction(context.Background(), zbaction.Action{
+		Variables: map[string]string{
+			"password": "p@ssw0rd",
+		},
+		Jobs: []zbaction.Job{
+			{
+				Steps: []zbaction.Step{
+					{
+						ID: "read-password",
+						RunnableStep: zbaction.CommandStep{
+							Command: []string{"grep", "-qx", "p@ssw0rd"},
+							Input:   "${password}\n",
+						},
+					},
+					{
+						ID: "produce",
+						RunnableStep: zbaction.CommandStep{
+							Command: []string{"echo", "from another step"},
+						},
+					},
+					{
+						RunnableStep: zbaction.CommandStep{
+							Command: []string{"tr", "a-z", "A-Z"},
+							Input:   "${out.produce.stdout}",
+						},
+					},
+				},
+			},
+		},
+	}, zbaction.WithCustomStdout(stdout))
+
+	assert.NoError(t, err)
+	assert.Equal(t, "from another step\nFROM ANOTHER STEP\n", stdout.String())
+}
+
+func TestCommandStep_LogDirectory(t *testing.T) {
+	for _, logDirectory := range []string{"", t.TempDir()} {
+		stdout := &bytes.Buffer{}
+		options := []zbaction.ExecutorOptionsFn{
+			zbaction.WithCustomStdout(stdout),
+			zbaction.WithOutputLimit(8),
+		}
+		if logDirectory != "" {
+			options = append(options, zbaction.WithLogDirectory(logDirectory))
+		}
+
+		result, err := zbaction.RunActionWithResult(context.Background(), zbaction.Action{
+			Jobs: []zbaction.Job{
+				{
+					ID: "build",
+					Steps: []zbaction.Step{
+						{
+							ID: "print",
+							RunnableStep: zbaction.CommandStep{
+								Command: []string{"echo", "0123456789abcdef"},
+							},
+						},
+						{
+							// the log file is readable by the later steps
+							RunnableStep: zbaction.CommandStep{
+								Command: []string{"cat", "${out.print.stdoutFile}"},
+							},
+						},
+					},
+				},
+			},
+		}, options...)
+		assert.NoError(t, err)
+		assert.Equal(t, "0123456789abcdef\n0123456789abcdef\n", stdout.String())
+
+		truncated, _ := result.GetOutput("print", "stdoutTruncated")
+		assert.Equal(t, true, truncated)
+
+		path, _ := result.GetOutput("print", "stdoutFile")
+		if !assert.NotEmpty(t, path) {
+			continue
+		}
+
+		if logDirectory == "" {
+			// the temporary log file is removed with the job
+			assert.NoFileExists(t, path.(string))
+			continue
+		}
+
+		assert.Equal(t, logDirectory, filepath.Dir(path.(string)))
+		content, err := os.ReadFile(path.(string))
+		assert.NoError(t, err)
+		assert.Equal(t, "0123456789abcdef\n", string(content))
+	}
+}
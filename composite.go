@@ -0,0 +1,140 @@
+package zbaction
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"slices"
+
+	"github.com/samber/lo"
+	"github.com/zeabur/action/proto"
+	"google.golang.org/protobuf/encoding/protojson"
+)
+
+// CompositeProcedure is a procedure which expands into a sequence of steps.
+//
+// The inputs are available as `${inputs.<name>}` in the steps. The steps
+// refer to each other with `${out.<step_id>.<key>}` as usual, while their IDs
+// are prefixed with the ID of the calling step (`<caller_id>/<step_id>`),
+// so they do not collide with the steps of the caller.
+type CompositeProcedure struct {
+	// Name is the name to register the procedure with.
+	Name ProcStepName
+	// Description is the human-readable description of the procedure.
+	Description string
+	// Inputs are the arguments the procedure accepts.
+	Inputs []ArgumentSchema
+	// Outputs are the outputs of the procedure, mapped from the outputs of the steps.
+	Outputs []CompositeOutput
+	// Steps are the steps to run.
+	Steps []Step
+}
+
+// CompositeOutput declares an output of a composite procedure.
+type CompositeOutput struct {
+	Name string
+	// Description is the human-readable description of the output.
+	Description string
+	// Value is the value of the output, such as `${out.build.image}`.
+	Value string
+}
+
+// Schema gets the schema of the composite procedure.
+func (c CompositeProcedure) Schema() *ProcedureSchema {
+	return &ProcedureSchema{
+		Description: c.Description,
+		Arguments:   c.Inputs,
+		Outputs: lo.Map(c.Outputs, func(output CompositeOutput, _ int) OutputSchema {
+			return OutputSchema{
+				Name:        output.Name,
+				Description: output.Description,
+			}
+		}),
+		Examples:   nil,
+		Deprecated: "",
+	}
+}
+
+// Builder gets the builder of the composite procedure.
+func (c CompositeProcedure) Builder() ProcedureStepBuilder {
+	return func(args ProcStepArgs) (ProcedureStep, error) {
+		return compositeStep{
+			procedure: c,
+			with:      args,
+		}, nil
+	}
+}
+
+// RegisterCompositeProcedure registers a composite procedure to the resolver.
+func RegisterCompositeProcedure(r ProcedureStepResolver, c CompositeProcedure) {
+	r.RegisterWithSchema(c.Name, c.Schema(), c.Builder())
+}
+
+// ReadCompositeProcedure reads a composite procedure from a protojson file.
+func ReadCompositeProcedure(file string) (CompositeProcedure, error) {
+	marshaled, err := os.ReadFile(file)
+	if err != nil {
+		return CompositeProcedure{}, fmt.Errorf("read file: %w", err)
+	}
+
+	p := &proto.CompositeProcedure{}
+	if err := protojson.Unmarshal(marshaled, p); err != nil {
+		return CompositeProcedure{}, fmt.Errorf("unmarshal composite procedure: %w", err)
+	}
+
+	composite, err := CompositeProcedureFromProto(p)
+	if err != nil {
+		return CompositeProcedure{}, fmt.Errorf("convert composite procedure: %w", err)
+	}
+
+	return composite, nil
+}
+
+type compositeStep struct {
+	procedure CompositeProcedure
+	with      ProcStepArgs
+}
+
+func (c compositeStep) Run(ctx context.Context, sc *StepContext) (CleanupFn, error) {
+	// a composite procedure may use itself through other composite procedures
+	composites := append(slices.Clone(sc.composites), c.procedure.Name)
+	if maxDepth := sc.jobContext.actionContext.maxActionDepth; len(composites) > maxDepth {
+		return nil, NewErrCompositeDepthExceeded(maxDepth, composites)
+	}
+
+	inputs := make(map[string]string, len(c.procedure.Inputs))
+	for _, input := range c.procedure.Inputs {
+		inputs["inputs."+input.Name] = sc.ExpandString(c.with[input.Name])
+	}
+
+	// scope is this step seen by the inner steps, where the inputs
+	// are available and the outputs of the inner steps are looked up first.
+	scope := *sc
+	scope.variables = NewVariableContainerWithParent(NewMapContainer(inputs), sc.variables)
+	scope.outputNamespace = sc.id + "/"
+	scope.composites = composites
+
+	cleanupStack := &CleanupStack{}
+
+	for _, step := range c.procedure.Steps {
+		if err := ctx.Err(); err != nil {
+			return cleanupStack.WrapRun(), err
+		}
+
+		innerSc := scope.newChildStepContext(step)
+
+		cleanup, err := sc.jobContext.runStep(ctx, step, innerSc)
+		if cleanup != nil {
+			cleanupStack.Push(cleanup)
+		}
+		if err != nil {
+			return cleanupStack.WrapRun(), fmt.Errorf("run step %s: %w", innerSc.ID(), err)
+		}
+	}
+
+	for _, output := range c.procedure.Outputs {
+		sc.SetThisOutput(output.Name, scope.ExpandString(output.Value))
+	}
+
+	return cleanupStack.WrapRun(), nil
+}
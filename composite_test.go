@@ -0,0 +1,150 @@
+package zbaction_test
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	zbaction "github.com/zeabur/action"
+)
+
+func TestCompositeProcedure(t *testing.T) {
+	r := zbaction.NewProcedureStepResolverWithParent(zbaction.GlobalProcedureResolver())
+	zbaction.RegisterCompositeProcedure(r, zbaction.CompositeProcedure{
+		Name: "test/greet",
+		Inputs: []zbaction.ArgumentSchema{
+			{Name: "name", Required: true},
+			{Name: "greeting", Default: "Hello"},
+		},
+		Outputs: []zbaction.CompositeOutput{
+			{Name: "message", Value: "${out.say.stdout}"},
+		},
+		Steps: []zbaction.Step{
+			{
+				ID: "say",
+				RunnableStep: zbaction.CommandStep{
+					Command: []string{"echo", "${inputs.greeting}, ${inputs.name}"},
+				},
+			},
+		},
+	})
+
+	stdout := &bytes.Buffer{}
+
+	err := zbaction.RunAction(context.Background(), zbaction.Action{
+		Jobs: []zbaction.Job{
+			{
+				Steps: []zbaction.Step{
+					{
+						ID: "say",
+						RunnableStep: zbaction.CommandStep{
+							Command: []string{"echo", "caller"},
+						},
+					},
+					{
+						ID: "greet",
+						RunnableStep: zbaction.ProcStep{
+							Uses: "test/greet",
+							With: zbaction.ProcStepArgs{"name": "${out.say.exitCode}"},
+						},
+					},
+					{
+						RunnableStep: zbaction.CommandStep{
+							Command: []string{"echo", "${out.greet.message}|${out.greet/say.exitCode}"},
+						},
+					},
+				},
+			},
+		},
+	}, zbaction.WithProcedureResolver(r), zbaction.WithCustomStdout(stdout))
+
+	assert.NoError(t, err)
+	assert.Equal(t, "caller\nHello, 0\nHello, 0\n|0\n", stdout.String())
+}
+
+func TestCompositeProcedure_Recursion(t *testing.T) {
+	r := zbaction.NewProcedureStepResolverWithParent(zbaction.GlobalProcedureResolver())
+	zbaction.RegisterCompositeProcedure(r, zbaction.CompositeProcedure{
+		Name: "test/ping",
+		Steps: []zbaction.Step{
+			{ID: "pong", RunnableStep: zbaction.ProcStep{Uses: "test/pong"}},
+		},
+	})
+	zbaction.RegisterCompositeProcedure(r, zbaction.CompositeProcedure{
+		Name: "test/pong",
+		Steps: []zbaction.Step{
+			{ID: "ping", RunnableStep: zbaction.ProcStep{Uses: "test/ping"}},
+		},
+	})
+
+	err := zbaction.RunAction(context.Background(), zbaction.Action{
+		Jobs: []zbaction.Job{
+			{
+				Steps: []zbaction.Step{
+					{ID: "ping", RunnableStep: zbaction.ProcStep{Uses: "test/ping"}},
+				},
+			},
+		},
+	}, zbaction.WithProcedureResolver(r), zbaction.WithMaxActionDepth(3))
+
+	var depthErr zbaction.ErrCompositeDepthExceeded
+	assert.ErrorAs(t, err, &depthErr)
+	assert.Equal(t, []zbaction.ProcStepName{"test/ping", "test/pong", "test/ping", "test/pong"}, depthErr.Composites)
+}
+
+func TestReadCompositeProcedure(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "composite.json")
+	assert.NoError(t, os.WriteFile(file, []byte(`{
+		"name": "test/build@1.0.0",
+		"inputs": [
+			{"name": "context", "required": true},
+			{"name": "push", "type": "bool", "default": "false"},
+			{"name": "platform", "enum": ["linux/amd64", "linux/arm64"]}
+		],
+		"outputs": [{"name": "image", "value": "${out.build.image}"}],
+		"steps": [{"id": "build", "command": {"command": ["true"]}}]
+	}`), 0o644))
+
+	composite, err := zbaction.ReadCompositeProcedure(file)
+	assert.NoError(t, err)
+	assert.Equal(t, zbaction.CompositeProcedure{
+		Name:        "test/build@1.0.0",
+		Description: "",
+		Inputs: []zbaction.ArgumentSchema{
+			{Name: "context", Type: zbaction.ArgumentTypeString, Required: true},
+			{Name: "push", Type: zbaction.ArgumentTypeBool, Default: "false"},
+			{Name: "platform", Type: zbaction.ArgumentTypeString, Enum: []string{"linux/amd64", "linux/arm64"}},
+		},
+		Outputs: []zbaction.CompositeOutput{
+			{Name: "image", Value: "${out.build.image}"},
+		},
+		Steps: []zbaction.Step{
+			{ID: "build", RunnableStep: zbaction.CommandStep{Command: []string{"true"}}},
+		},
+	}, composite)
+
+	// the input schemas survive the round trip
+	p, err := zbaction.CompositeProcedureToProto(composite)
+	assert.NoError(t, err)
+	roundTripped, err := zbaction.CompositeProcedureFromProto(p)
+	assert.NoError(t, err)
+	assert.Equal(t, composite.Inputs, roundTripped.Inputs)
+
+	// and validate the arguments
+	r := zbaction.NewProcedureStepResolver()
+	zbaction.RegisterCompositeProcedure(r, composite)
+	_, err = r.Resolve("test/build@1.0.0", zbaction.ProcStepArgs{"context": ".", "push": "maybe"})
+	assert.Error(t, err)
+	_, err = r.Resolve("test/build@1.0.0", zbaction.ProcStepArgs{"context": ".", "platform": "windows/amd64"})
+	assert.Error(t, err)
+
+	assert.NoError(t, os.WriteFile(file, []byte(`{
+		"name": "test/build@1.0.0",
+		"inputs": [{"name": "context", "type": "path"}]
+	}`), 0o644))
+	_, err = zbaction.ReadCompositeProcedure(file)
+	assert.ErrorContains(t, err, "unknown type")
+}
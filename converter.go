@@ -2,7 +2,9 @@ package zbaction
 
 import (
 	"fmt"
+	"time"
 
+	"github.com/samber/lo"
 	"github.com/zeabur/action/proto"
 )
 
@@ -13,6 +15,7 @@ func ActionToProto(action Action) (*proto.Action, error) {
 		Variables:    action.Variables,
 		Requirements: make([]*proto.Requirement, len(action.Requirements)),
 		Metadata:     action.Metadata,
+		Defaults:     defaultsToProto(action.Defaults),
 	}
 
 	for requirementIndex, requirement := range action.Requirements {
@@ -23,28 +26,18 @@ func ActionToProto(action Action) (*proto.Action, error) {
 	}
 
 	for jobIndex, job := range action.Jobs {
-		pj := &proto.Job{
-			Id:        job.ID,
-			Steps:     make([]*proto.Step, len(job.Steps)),
-			Variables: job.Variables,
+		steps, err := stepsToProto(job.Steps)
+		if err != nil {
+			return nil, err
 		}
 
-		for stepIndex, step := range job.Steps {
-			ps := &proto.Step{
-				Id:        step.ID,
-				Name:      step.Name,
-				Step:      nil,
-				Variables: step.Variables,
-			}
-
-			if err := exactStepToProto(step, ps); err != nil {
-				return nil, fmt.Errorf("failed to convert step %s to proto: %w", step.ID, err)
-			}
-
-			pj.Steps[stepIndex] = ps
+		p.Jobs[jobIndex] = &proto.Job{
+			Id:        job.ID,
+			Steps:     steps,
+			Variables: job.Variables,
+			Defaults:  defaultsToProto(job.Defaults),
+			Limits:    resourceLimitsToProto(job.Limits),
 		}
-
-		p.Jobs[jobIndex] = pj
 	}
 
 	return p, nil
@@ -57,6 +50,7 @@ func ActionFromProto(p *proto.Action) (Action, error) {
 		Variables:    p.Variables,
 		Requirements: make([]Requirement, len(p.Requirements)),
 		Metadata:     p.Metadata,
+		Defaults:     defaultsFromProto(p.Defaults),
 	}
 
 	for requirementIndex, requirement := range p.Requirements {
@@ -67,30 +61,151 @@ func ActionFromProto(p *proto.Action) (Action, error) {
 	}
 
 	for jobIndex, job := range p.Jobs {
-		j := Job{
+		steps, err := stepsFromProto(job.Steps)
+		if err != nil {
+			return Action{}, err
+		}
+
+		action.Jobs[jobIndex] = Job{
 			ID:        job.Id,
-			Steps:     make([]Step, len(job.Steps)),
+			Steps:     steps,
 			Variables: job.Variables,
+			Defaults:  defaultsFromProto(job.Defaults),
+			Limits:    resourceLimitsFromProto(job.Limits),
 		}
+	}
 
-		for stepIndex, step := range job.Steps {
-			s, err := exactStepFromProto(step)
-			if err != nil {
-				return Action{}, fmt.Errorf("failed to convert step %s from proto: %w", step.Id, err)
-			}
+	return action, nil
+}
 
-			j.Steps[stepIndex] = Step{
-				ID:           step.Id,
-				Name:         step.Name,
-				RunnableStep: s,
-				Variables:    step.Variables,
-			}
+// CompositeProcedureToProto converts a composite procedure to its protobuf form.
+func CompositeProcedureToProto(composite CompositeProcedure) (*proto.CompositeProcedure, error) {
+	steps, err := stepsToProto(composite.Steps)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &proto.CompositeProcedure{
+		Name:        composite.Name,
+		Description: composite.Description,
+		Inputs:      make([]*proto.CompositeInput, len(composite.Inputs)),
+		Outputs:     make([]*proto.CompositeOutput, len(composite.Outputs)),
+		Steps:       steps,
+	}
+
+	for inputIndex, input := range composite.Inputs {
+		p.Inputs[inputIndex] = &proto.CompositeInput{
+			Name:        input.Name,
+			Description: input.Description,
+			Required:    input.Required,
+			Default:     input.Default,
+			Type:        string(input.Type),
+			Enum:        input.Enum,
 		}
+	}
 
-		action.Jobs[jobIndex] = j
+	for outputIndex, output := range composite.Outputs {
+		p.Outputs[outputIndex] = &proto.CompositeOutput{
+			Name:        output.Name,
+			Description: output.Description,
+			Value:       output.Value,
+		}
 	}
 
-	return action, nil
+	return p, nil
+}
+
+// CompositeProcedureFromProto converts a composite procedure from its protobuf form.
+func CompositeProcedureFromProto(p *proto.CompositeProcedure) (CompositeProcedure, error) {
+	steps, err := stepsFromProto(p.Steps)
+	if err != nil {
+		return CompositeProcedure{}, err
+	}
+
+	composite := CompositeProcedure{
+		Name:        p.Name,
+		Description: p.Description,
+		Inputs:      make([]ArgumentSchema, len(p.Inputs)),
+		Outputs:     make([]CompositeOutput, len(p.Outputs)),
+		Steps:       steps,
+	}
+
+	for inputIndex, input := range p.Inputs {
+		argumentType := ArgumentType(input.Type)
+		switch argumentType {
+		case "":
+			argumentType = ArgumentTypeString
+		case ArgumentTypeString, ArgumentTypeBool, ArgumentTypeInt:
+		default:
+			return CompositeProcedure{}, fmt.Errorf("input %s: unknown type %s", input.Name, input.Type)
+		}
+
+		composite.Inputs[inputIndex] = ArgumentSchema{
+			Name:        input.Name,
+			Type:        argumentType,
+			Required:    input.Required,
+			Default:     input.Default,
+			Enum:        input.Enum,
+			Description: input.Description,
+		}
+	}
+
+	for outputIndex, output := range p.Outputs {
+		composite.Outputs[outputIndex] = CompositeOutput{
+			Name:        output.Name,
+			Description: output.Description,
+			Value:       output.Value,
+		}
+	}
+
+	return composite, nil
+}
+
+func stepsToProto(steps []Step) ([]*proto.Step, error) {
+	p := make([]*proto.Step, len(steps))
+
+	for stepIndex, step := range steps {
+		ps := &proto.Step{
+			Id:                       step.ID,
+			Name:                     step.Name,
+			Step:                     nil,
+			Variables:                step.Variables,
+			WorkingDirectory:         step.WorkingDirectory,
+			Limits:                   resourceLimitsToProto(step.Limits),
+			InactivityTimeoutSeconds: durationToSeconds(step.InactivityTimeout),
+		}
+
+		if err := exactStepToProto(step, ps); err != nil {
+			return nil, fmt.Errorf("failed to convert step %s to proto: %w", step.ID, err)
+		}
+
+		p[stepIndex] = ps
+	}
+
+	return p, nil
+}
+
+func stepsFromProto(p []*proto.Step) ([]Step, error) {
+	steps := make([]Step, len(p))
+
+	for stepIndex, step := range p {
+		s, err := exactStepFromProto(step)
+		if err != nil {
+			return nil, fmt.Errorf("failed to convert step %s from proto: %w", step.Id, err)
+		}
+
+		steps[stepIndex] = Step{
+			ID:                step.Id,
+			Name:              step.Name,
+			RunnableStep:      s,
+			Variables:         step.Variables,
+			WorkingDirectory:  step.WorkingDirectory,
+			Limits:            resourceLimitsFromProto(step.Limits),
+			InactivityTimeout: time.Duration(step.InactivityTimeoutSeconds) * time.Second,
+		}
+	}
+
+	return steps, nil
 }
 
 func exactStepToProto(step Step, out *proto.Step) error {
@@ -100,7 +215,10 @@ func exactStepToProto(step Step, out *proto.Step) error {
 	case CommandStep:
 		out.Step = &proto.Step_Command{
 			Command: &proto.CommandStep{
-				Command: runnableStep.Command,
+				Command:           runnableStep.Command,
+				Shell:             runnableStep.Shell,
+				AcceptedExitCodes: exitCodesToProto(runnableStep.AcceptedExitCodes),
+				Input:             runnableStep.Input,
 			},
 		}
 	case ProcStep:
@@ -110,6 +228,24 @@ func exactStepToProto(step Step, out *proto.Step) error {
 				With: runnableStep.With,
 			},
 		}
+	case ActionStep:
+		p := &proto.ActionStep{
+			Source:  nil,
+			With:    runnableStep.With,
+			Outputs: runnableStep.Outputs,
+		}
+
+		if runnableStep.Action != nil {
+			action, err := ActionToProto(*runnableStep.Action)
+			if err != nil {
+				return fmt.Errorf("convert nested action: %w", err)
+			}
+			p.Source = &proto.ActionStep_Action{Action: action}
+		} else {
+			p.Source = &proto.ActionStep_Path{Path: runnableStep.Path}
+		}
+
+		out.Step = &proto.Step_Action{Action: p}
 	default:
 		return fmt.Errorf("unknown step type received: %T (%+v)", runnableStep, runnableStep)
 	}
@@ -123,16 +259,113 @@ func exactStepFromProto(p *proto.Step) (RunnableStep, error) {
 	switch p := p.Step.(type) {
 	case *proto.Step_Command:
 		step = CommandStep{
-			Command: p.Command.Command,
+			Command:           p.Command.Command,
+			Shell:             p.Command.Shell,
+			AcceptedExitCodes: exitCodesFromProto(p.Command.AcceptedExitCodes),
+			Input:             p.Command.Input,
 		}
 	case *proto.Step_Proc:
 		step = ProcStep{
 			Uses: p.Proc.Uses,
 			With: p.Proc.With,
 		}
+	case *proto.Step_Action:
+		actionStep := ActionStep{
+			Action:  nil,
+			Path:    p.Action.GetPath(),
+			With:    p.Action.With,
+			Outputs: p.Action.Outputs,
+		}
+
+		if nested := p.Action.GetAction(); nested != nil {
+			action, err := ActionFromProto(nested)
+			if err != nil {
+				return nil, fmt.Errorf("convert nested action: %w", err)
+			}
+			actionStep.Action = &action
+		}
+
+		step = actionStep
 	default:
 		return Step{}, fmt.Errorf("unknown step type received: %T (%+v)", p, p)
 	}
 
 	return step, nil
 }
+
+func defaultsToProto(defaults Defaults) *proto.Defaults {
+	if defaults.IsZero() {
+		return nil
+	}
+
+	return &proto.Defaults{
+		WorkingDirectory:         defaults.WorkingDirectory,
+		Shell:                    defaults.Shell,
+		Environment:              defaults.Environment,
+		InactivityTimeoutSeconds: durationToSeconds(defaults.InactivityTimeout),
+	}
+}
+
+func defaultsFromProto(p *proto.Defaults) Defaults {
+	if p == nil {
+		return Defaults{}
+	}
+
+	return Defaults{
+		WorkingDirectory:  p.WorkingDirectory,
+		Shell:             p.Shell,
+		Environment:       p.Environment,
+		InactivityTimeout: time.Duration(p.InactivityTimeoutSeconds) * time.Second,
+	}
+}
+
+func exitCodesToProto(codes []int) []int32 {
+	if codes == nil {
+		return nil
+	}
+
+	return lo.Map(codes, func(code int, _ int) int32 {
+		return int32(code)
+	})
+}
+
+func exitCodesFromProto(codes []int32) []int {
+	if codes == nil {
+		return nil
+	}
+
+	return lo.Map(codes, func(code int32, _ int) int {
+		return int(code)
+	})
+}
+
+func resourceLimitsToProto(limits ResourceLimits) *proto.ResourceLimits {
+	if limits.IsZero() {
+		return nil
+	}
+
+	return &proto.ResourceLimits{
+		MaxMemory:         limits.MaxMemory,
+		MaxCpuTimeSeconds: durationToSeconds(limits.MaxCPUTime),
+		MaxOpenFiles:      limits.MaxOpenFiles,
+		MaxProcesses:      limits.MaxProcesses,
+	}
+}
+
+func resourceLimitsFromProto(p *proto.ResourceLimits) ResourceLimits {
+	if p == nil {
+		return ResourceLimits{}
+	}
+
+	return ResourceLimits{
+		MaxMemory:    p.MaxMemory,
+		MaxCPUTime:   time.Duration(p.MaxCpuTimeSeconds) * time.Second,
+		MaxOpenFiles: p.MaxOpenFiles,
+		MaxProcesses: p.MaxProcesses,
+	}
+}
+
+// durationToSeconds converts the duration to seconds, rounding up.
+func durationToSeconds(d time.Duration) int64 {
+	return int64((d + time.Second - 1) / time.Second)
+}
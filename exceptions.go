@@ -1,5 +1,11 @@
 package zbaction
 
+import (
+	"strconv"
+	"strings"
+	"time"
+)
+
 type ErrRequiredArgument struct {
 	Key string
 }
@@ -13,3 +19,132 @@ func NewErrRequiredArgument(key string) ErrRequiredArgument {
 func (r ErrRequiredArgument) Error() string {
 	return "missing required argument: " + r.Key
 }
+
+type ErrPathOutsideRoot struct {
+	Path string
+}
+
+func NewErrPathOutsideRoot(path string) ErrPathOutsideRoot {
+	return ErrPathOutsideRoot{
+		Path: path,
+	}
+}
+
+func (r ErrPathOutsideRoot) Error() string {
+	return "path is outside the root: " + r.Path
+}
+
+type ErrResourceLimitExceeded struct {
+	Resource Resource
+	Err      error
+}
+
+func NewErrResourceLimitExceeded(resource Resource, err error) ErrResourceLimitExceeded {
+	return ErrResourceLimitExceeded{
+		Resource: resource,
+		Err:      err,
+	}
+}
+
+func (r ErrResourceLimitExceeded) Error() string {
+	return "resource limit exceeded: " + r.Resource + ": " + r.Err.Error()
+}
+
+func (r ErrResourceLimitExceeded) Unwrap() error {
+	return r.Err
+}
+
+type ErrResourceLimitUnsupported struct {
+	Resource Resource
+	Err      error
+}
+
+func NewErrResourceLimitUnsupported(resource Resource, err error) ErrResourceLimitUnsupported {
+	return ErrResourceLimitUnsupported{
+		Resource: resource,
+		Err:      err,
+	}
+}
+
+func (r ErrResourceLimitUnsupported) Error() string {
+	return "resource limit can't be enforced: " + r.Resource + ": " + r.Err.Error()
+}
+
+func (r ErrResourceLimitUnsupported) Unwrap() error {
+	return r.Err
+}
+
+type ErrNoOutput struct {
+	Timeout time.Duration
+}
+
+func NewErrNoOutput(timeout time.Duration) ErrNoOutput {
+	return ErrNoOutput{
+		Timeout: timeout,
+	}
+}
+
+func (r ErrNoOutput) Error() string {
+	return "no output for " + r.Timeout.String()
+}
+
+type ErrUnknownArgument struct {
+	Key string
+}
+
+func NewErrUnknownArgument(key string) ErrUnknownArgument {
+	return ErrUnknownArgument{
+		Key: key,
+	}
+}
+
+func (r ErrUnknownArgument) Error() string {
+	return "unknown argument: " + r.Key
+}
+
+type ErrInvalidArgument struct {
+	Key    string
+	Reason string
+}
+
+func NewErrInvalidArgument(key string, reason string) ErrInvalidArgument {
+	return ErrInvalidArgument{
+		Key:    key,
+		Reason: reason,
+	}
+}
+
+func (r ErrInvalidArgument) Error() string {
+	return "invalid argument " + r.Key + ": " + r.Reason
+}
+
+type ErrActionDepthExceeded struct {
+	MaxDepth int
+}
+
+func NewErrActionDepthExceeded(maxDepth int) ErrActionDepthExceeded {
+	return ErrActionDepthExceeded{
+		MaxDepth: maxDepth,
+	}
+}
+
+func (r ErrActionDepthExceeded) Error() string {
+	return "nested action depth exceeds " + strconv.Itoa(r.MaxDepth)
+}
+
+type ErrCompositeDepthExceeded struct {
+	MaxDepth int
+	// Composites are the nested composite procedures, from the outermost one.
+	Composites []ProcStepName
+}
+
+func NewErrCompositeDepthExceeded(maxDepth int, composites []ProcStepName) ErrCompositeDepthExceeded {
+	return ErrCompositeDepthExceeded{
+		MaxDepth:   maxDepth,
+		Composites: composites,
+	}
+}
+
+func (r ErrCompositeDepthExceeded) Error() string {
+	return "nested composite procedure depth exceeds " + strconv.Itoa(r.MaxDepth) + ": " + strings.Join(r.Composites, " -> ")
+}
@@ -6,8 +6,10 @@ import (
 	"fmt"
 	"io"
 	"log/slog"
+	"maps"
 	"os"
 	"strings"
+	"time"
 
 	"golang.org/x/sync/errgroup"
 )
@@ -16,13 +18,33 @@ type StepsOutputMap map[StepID]StepOutput
 type StepOutput = map[string]any
 
 func RunAction(ctx context.Context, action Action, options ...ExecutorOptionsFn) error {
+	_, err := RunActionWithResult(ctx, action, options...)
+	return err
+}
+
+// RunActionWithResult runs the action, and returns the result of the steps.
+//
+// The result is returned even if the action failed,
+// with the steps which have run until the failure.
+func RunActionWithResult(ctx context.Context, action Action, options ...ExecutorOptionsFn) (ActionResult, error) {
 	slog.Info("Running action", slog.String("action", action.String()))
 
 	executorOptions := ExecutorOptions{
 		/* defaults */
-		RuntimeVariables: nil,
-		Stdout:           os.Stdout,
-		Stderr:           os.Stderr,
+		RuntimeVariables:  nil,
+		Stdout:            os.Stdout,
+		Stderr:            os.Stderr,
+		OutputLimit:       DefaultOutputLimit,
+		KillGracePeriod:   DefaultKillGracePeriod,
+		ProcedureResolver: resolver,
+		LogOptions: LogOptions{
+			Format:     LogFormatRaw,
+			Timestamps: false,
+		},
+		MaxActionDepth:           DefaultMaxActionDepth,
+		LogDirectory:             "",
+		BestEffortResourceLimits: false,
+		depth:                    0,
 	}
 	for _, fn := range options {
 		fn(&executorOptions)
@@ -34,10 +56,29 @@ func RunAction(ctx context.Context, action Action, options ...ExecutorOptionsFn)
 	}
 
 	ac := &ActionContext{
-		variables: variables,
-		action:    &action,
-		stdout:    executorOptions.Stdout,
-		stderr:    executorOptions.Stderr,
+		variables:         variables,
+		runtimeVariables:  executorOptions.RuntimeVariables,
+		action:            &action,
+		stdout:            executorOptions.Stdout,
+		stderr:            executorOptions.Stderr,
+		outputLimit:       executorOptions.OutputLimit,
+		killGracePeriod:   executorOptions.KillGracePeriod,
+		logOptions:        executorOptions.LogOptions,
+		procedureResolver: executorOptions.ProcedureResolver,
+		maxActionDepth:    executorOptions.MaxActionDepth,
+		logDirectory:      executorOptions.LogDirectory,
+		bestEffortLimits:  executorOptions.BestEffortResourceLimits,
+		depth:             executorOptions.depth,
+	}
+
+	result := ActionResult{
+		ID:   action.String(),
+		Jobs: make([]JobResult, len(action.Jobs)),
+	}
+
+	if ac.depth > ac.maxActionDepth {
+		err := NewErrActionDepthExceeded(ac.maxActionDepth)
+		return result, fmt.Errorf("run action %s: %w", action.String(), err)
 	}
 
 	type CleanupFnContext struct {
@@ -63,8 +104,10 @@ func RunAction(ctx context.Context, action Action, options ...ExecutorOptionsFn)
 
 	eg, ectx := errgroup.WithContext(ctx)
 
-	for _, job := range action.Jobs {
+	for jobIndex, job := range action.Jobs {
 		job := job
+		jobResult := &result.Jobs[jobIndex]
+		jobResult.ID = job.String()
 
 		eg.Go(func() error {
 			jc := &JobContext{
@@ -72,6 +115,7 @@ func RunAction(ctx context.Context, action Action, options ...ExecutorOptionsFn)
 				job:           &job,
 				output:        make(StepsOutputMap),
 				variables:     NewMapContainer(job.Variables),
+				result:        jobResult,
 			}
 			defer func(jc *JobContext, job Job) {
 				jobCleanupFn <- CleanupFnContext{
@@ -102,19 +146,39 @@ func RunAction(ctx context.Context, action Action, options ...ExecutorOptionsFn)
 		slog.Error("Failed to run action",
 			slog.String("action", action.String()),
 			slog.String("error", err.Error()))
-		return fmt.Errorf("run action %s: %w", action.String(), err)
+		return result, fmt.Errorf("run action %s: %w", action.String(), err)
 	}
 
-	return nil
+	return result, nil
 }
 
 type ActionContext struct {
 	variables VariableContainer
-	action    *Action
+	// runtimeVariables is the runtime variables, which are passed to the nested actions.
+	runtimeVariables map[string]string
+	action           *Action
 
 	stdout io.Writer
 	stderr io.Writer
 
+	// outputLimit is the number of bytes of a stream kept in memory.
+	outputLimit int
+	// killGracePeriod is the time between SIGTERM and SIGKILL
+	// when a command is cancelled.
+	killGracePeriod time.Duration
+	logOptions      LogOptions
+	// procedureResolver resolves the procedures of ProcStep.
+	procedureResolver ProcedureStepResolver
+	// maxActionDepth is the maximum depth of the nested actions.
+	maxActionDepth int
+	// logDirectory is the directory owned by the caller to keep the log files.
+	// If it is empty, each job creates a temporary one.
+	logDirectory string
+	// bestEffortLimits runs the commands whose resource limits can't be enforced.
+	bestEffortLimits bool
+	// depth is the depth of this action. The root action is 0.
+	depth int
+
 	cachedID *ActionID `exhaustruct:"optional"`
 }
 
@@ -127,6 +191,21 @@ func (ac *ActionContext) ID() ActionID {
 	return *ac.cachedID
 }
 
+// inheritOptions passes the options of this action to a nested action.
+func (ac *ActionContext) inheritOptions(o *ExecutorOptions) {
+	o.RuntimeVariables = maps.Clone(ac.runtimeVariables)
+	o.Stdout = ac.stdout
+	o.Stderr = ac.stderr
+	o.OutputLimit = ac.outputLimit
+	o.KillGracePeriod = ac.killGracePeriod
+	o.LogOptions = ac.logOptions
+	o.ProcedureResolver = ac.procedureResolver
+	o.MaxActionDepth = ac.maxActionDepth
+	o.LogDirectory = ac.logDirectory
+	o.BestEffortResourceLimits = ac.bestEffortLimits
+	o.depth = ac.depth + 1
+}
+
 func (ac *ActionContext) VariableContainer() VariableContainer {
 	return ac.variables
 }
@@ -149,8 +228,11 @@ type JobContext struct {
 
 	output    map[StepID]StepOutput
 	variables VariableContainer
+	// result records the steps which have run.
+	result *JobResult
 
-	root *string `exhaustruct:"optional"`
+	root         *string `exhaustruct:"optional"`
+	logDirectory *string `exhaustruct:"optional"`
 
 	// cache
 
@@ -213,12 +295,44 @@ func (jc *JobContext) GetRoot() (string, error) {
 	return tmpdir, nil
 }
 
+// GetLogDirectory gets the directory to store the logs of the steps in this job.
+//
+// It is separated from the job root, so the logs will not be
+// picked up by the steps operating on the job root (e.g. a build context).
+// It is the log directory of the action if specified, which is kept after
+// the job; otherwise, it is a temporary directory removed in Cleanup.
+func (jc *JobContext) GetLogDirectory() (string, error) {
+	if jc.logDirectory != nil {
+		return *jc.logDirectory, nil
+	}
+
+	if dir := jc.actionContext.logDirectory; dir != "" {
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			return "", fmt.Errorf("create log directory: %w", err)
+		}
+		return dir, nil
+	}
+
+	tmpdir, err := os.MkdirTemp("", "zbaction-logs-*")
+	if err != nil {
+		return "", fmt.Errorf("create log directory: %w", err)
+	}
+
+	jc.logDirectory = &tmpdir
+	return tmpdir, nil
+}
+
 func (jc *JobContext) Cleanup() error {
-	if jc.root == nil {
-		return nil
+	var errs []error
+
+	if jc.root != nil {
+		errs = append(errs, os.RemoveAll(*jc.root))
+	}
+	if jc.logDirectory != nil {
+		errs = append(errs, os.RemoveAll(*jc.logDirectory))
 	}
 
-	return os.RemoveAll(*jc.root)
+	return errors.Join(errs...)
 }
 
 func (jc *JobContext) Run(ctx context.Context) error {
@@ -242,20 +356,26 @@ func (jc *JobContext) Run(ctx context.Context) error {
 		slog.Info("Running step", slog.String("step", step.HumanName()))
 
 		sc := &StepContext{
-			id:         step.String(),
-			jobContext: jc,
-			root:       root,
-			variables:  NewMapContainer(step.Variables),
+			id:               step.String(),
+			name:             step.HumanName(),
+			jobContext:       jc,
+			root:             root,
+			workingDirectory: step.WorkingDirectory,
+			limits:           step.Limits,
+			variables:        NewMapContainer(step.Variables),
+			report:           &stepReport{},
+			logs:             &stepLogs{},
 		}
 
 		if err := ctx.Err(); err != nil {
 			return err
 		}
 
-		cleanup, err := step.Run(ctx, sc)
+		cleanup, err := jc.runStep(ctx, step, sc)
 		if cleanup != nil {
 			cleanupStack.Push(cleanup)
 		}
+		jc.recordStep(sc, err)
 		if err != nil {
 			slog.Error("Failed to run step",
 				slog.String("step", step.String()),
@@ -267,22 +387,164 @@ func (jc *JobContext) Run(ctx context.Context) error {
 	return nil
 }
 
+// recordStep records the result of a step to the job result.
+func (jc *JobContext) recordStep(sc *StepContext, err error) {
+	if jc.result == nil {
+		return
+	}
+
+	annotations, summary := sc.report.snapshot()
+
+	stepResult := StepResult{
+		ID:          sc.id,
+		Name:        sc.name,
+		Outputs:     jc.output[sc.id],
+		Error:       "",
+		Action:      sc.actionResult,
+		Annotations: annotations,
+		Summary:     summary,
+	}
+	if err != nil {
+		stepResult.Error = err.Error()
+	}
+
+	jc.result.Steps = append(jc.result.Steps, stepResult)
+}
+
+// runStep runs the step, and cancels it with ErrNoOutput
+// if it has no output for the inactivity timeout.
+func (jc *JobContext) runStep(ctx context.Context, step Step, sc *StepContext) (CleanupFn, error) {
+	defer sc.flushLogs()
+
+	timeout := step.InactivityTimeout
+	if timeout <= 0 {
+		timeout = sc.Defaults().InactivityTimeout
+	}
+	if timeout <= 0 {
+		return step.Run(ctx, sc)
+	}
+
+	ctx, cancel := context.WithCancelCause(ctx)
+	defer cancel(nil)
+
+	sc.watchdog = newInactivityWatchdog(timeout, func() {
+		slog.Warn("Step has no output, cancelling",
+			slog.String("step", step.String()),
+			slog.Duration("timeout", timeout))
+		cancel(NewErrNoOutput(timeout))
+	})
+	defer sc.watchdog.Stop()
+
+	cleanup, err := step.Run(ctx, sc)
+	if err != nil {
+		var errNoOutput ErrNoOutput
+		if cause := context.Cause(ctx); errors.As(cause, &errNoOutput) {
+			return cleanup, fmt.Errorf("%w: %s", cause, err)
+		}
+	}
+
+	return cleanup, err
+}
+
 type StepContext struct {
 	id         StepID
+	name       string
 	jobContext *JobContext
 
-	root      string
-	variables VariableContainer
+	root             string
+	workingDirectory string
+	limits           ResourceLimits
+	variables        VariableContainer
+
+	// watchdog is touched when this step writes to stdout or stderr.
+	watchdog *inactivityWatchdog `exhaustruct:"optional"`
+
+	// parent is the step this step is nested in, such as a composite procedure.
+	parent *StepContext `exhaustruct:"optional"`
+	// outputNamespace is the prefix of the step IDs looked up first
+	// in `${out.<step_id>.<key>}`, so the nested steps refer to their siblings.
+	outputNamespace string `exhaustruct:"optional"`
+	// actionResult is the result of the nested action run by this step.
+	actionResult *ActionResult `exhaustruct:"optional"`
+	// report collects the annotations and the summary of this step.
+	report *stepReport `exhaustruct:"optional"`
+	// logs formats stdout and stderr of this step.
+	logs *stepLogs `exhaustruct:"optional"`
+	// composites are the composite procedures this step is nested in,
+	// from the outermost one.
+	composites []ProcStepName `exhaustruct:"optional"`
+}
+
+// newChildStepContext creates the context of a step nested in this step.
+//
+// The ID of the nested step is prefixed with the ID of this step,
+// so it does not collide with the steps of the job. The nested step
+// inherits the working directory and the resource limits of this step.
+func (sc *StepContext) newChildStepContext(step Step) *StepContext {
+	workingDirectory := step.WorkingDirectory
+	if workingDirectory == "" {
+		workingDirectory = sc.workingDirectory
+	}
+
+	return &StepContext{
+		id:               sc.id + "/" + step.String(),
+		name:             sc.name + " / " + step.HumanName(),
+		jobContext:       sc.jobContext,
+		root:             sc.root,
+		workingDirectory: workingDirectory,
+		limits:           sc.limits.Narrow(step.Limits),
+		variables:        NewVariableContainerWithParent(NewMapContainer(step.Variables), sc.variables),
+		parent:           sc,
+		outputNamespace:  sc.id + "/",
+		report:           sc.report,
+		logs:             &stepLogs{},
+		composites:       sc.composites,
+	}
 }
 
 func (sc *StepContext) Root() string {
 	return sc.root
 }
 
+// Defaults gets the effective defaults of this step,
+// which merges the defaults of the job into the defaults of the action.
+func (sc *StepContext) Defaults() Defaults {
+	return sc.jobContext.actionContext.action.Defaults.Override(sc.jobContext.job.Defaults)
+}
+
+// WorkingDirectory gets the absolute working directory of this step.
+//
+// It falls back to the default working directory, and then to the job root.
+// An error is returned if the working directory escapes the job root.
+func (sc *StepContext) WorkingDirectory() (string, error) {
+	wd := sc.workingDirectory
+	if wd == "" {
+		wd = sc.Defaults().WorkingDirectory
+	}
+
+	return ResolvePath(sc.Root(), sc.ExpandString(wd))
+}
+
 func (sc *StepContext) ID() StepID {
 	return sc.id
 }
 
+// ResourceLimits gets the effective resource limits of this step,
+// which are the limits of the step narrowed by the limits of the job.
+func (sc *StepContext) ResourceLimits() ResourceLimits {
+	return sc.jobContext.job.Limits.Narrow(sc.limits)
+}
+
+// ProcedureResolver gets the resolver of the procedures of this action.
+func (sc *StepContext) ProcedureResolver() ProcedureStepResolver {
+	return sc.jobContext.actionContext.procedureResolver
+}
+
+// Name gets the human-readable name of this step.
+func (sc *StepContext) Name() string {
+	return sc.name
+}
+
 func (sc *StepContext) JobContext() JobContext {
 	return *sc.jobContext
 }
@@ -306,11 +568,20 @@ func (sc *StepContext) GetThisOutput(key string) (any, bool) {
 	return sc.GetOutput(sc.id, key)
 }
 
+// GetOutput gets the output of a step.
+//
+// For a nested step, the sibling step with the ID is looked up first.
 func (sc *StepContext) GetOutput(id StepID, key string) (any, bool) {
 	if sc.jobContext.output == nil {
 		return nil, false
 	}
 
+	if sc.outputNamespace != "" {
+		if value, ok := sc.jobContext.output[sc.outputNamespace+id][key]; ok {
+			return value, true
+		}
+	}
+
 	if sc.jobContext.output[id] == nil {
 		return nil, false
 	}
@@ -341,12 +612,49 @@ func (sc *StepContext) ExpandString(s string) string {
 	})
 }
 
-// Stdout gets the user-specified stdout writer of this step.
+// Stdout gets the user-specified stdout writer of this step,
+// which formats the logs with the log options of the action.
 func (sc *StepContext) Stdout() io.Writer {
-	return sc.jobContext.actionContext.stdout
+	return sc.watch(sc.format("stdout", sc.jobContext.actionContext.stdout))
 }
 
-// Stderr gets the user-specified stderr writer of this step.
+// Stderr gets the user-specified stderr writer of this step,
+// which formats the logs with the log options of the action.
 func (sc *StepContext) Stderr() io.Writer {
-	return sc.jobContext.actionContext.stderr
+	return sc.watch(sc.format("stderr", sc.jobContext.actionContext.stderr))
+}
+
+// format wraps target to format the stream of this step with the log options.
+func (sc *StepContext) format(stream string, target io.Writer) io.Writer {
+	options := sc.jobContext.actionContext.logOptions
+	if sc.logs == nil || (options.Format == LogFormatRaw && !options.Timestamps) {
+		return target
+	}
+
+	return sc.logs.writer(target, options, sc.jobContext.ID(), sc.Name(), stream)
+}
+
+// flushLogs writes the remaining incomplete lines of this step.
+func (sc *StepContext) flushLogs() {
+	if sc.logs == nil {
+		return
+	}
+
+	if err := sc.logs.Flush(); err != nil {
+		slog.Error("Failed to flush logs",
+			slog.String("step", sc.id),
+			slog.String("error", err.Error()))
+	}
+}
+
+// watch wraps w to touch the watchdogs of this step and the steps it is nested in.
+// It wraps the log formatter, so the incomplete lines touch the watchdogs as well.
+func (sc *StepContext) watch(w io.Writer) io.Writer {
+	for s := sc; s != nil; s = s.parent {
+		if s.watchdog != nil {
+			w = s.watchdog.Writer(w)
+		}
+	}
+
+	return w
 }
@@ -0,0 +1,56 @@
+package zbaction_test
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	zbaction "github.com/zeabur/action"
+)
+
+type printStep struct {
+	stdout string
+	stderr string
+}
+
+func (s printStep) Run(_ context.Context, sc *zbaction.StepContext) (zbaction.CleanupFn, error) {
+	_, _ = fmt.Fprint(sc.Stdout(), s.stdout)
+	_, _ = fmt.Fprint(sc.Stderr(), s.stderr)
+	return nil, nil
+}
+
+func TestStepContext_LogFormatJSON(t *testing.T) {
+	r := zbaction.NewProcedureStepResolverWithParent(zbaction.GlobalProcedureResolver())
+	r.Register("test/print", func(zbaction.ProcStepArgs) (zbaction.ProcedureStep, error) {
+		// the incomplete line is flushed when the step ends
+		return printStep{stdout: "hello\nwor", stderr: "oops\n"}, nil
+	})
+
+	stdout := &bytes.Buffer{}
+	stderr := &bytes.Buffer{}
+
+	err := zbaction.RunAction(context.Background(), zbaction.Action{
+		Jobs: []zbaction.Job{
+			{
+				ID: "build",
+				Steps: []zbaction.Step{
+					{ID: "print", Name: "Print", RunnableStep: zbaction.ProcStep{Uses: "test/print"}},
+				},
+			},
+		},
+	},
+		zbaction.WithProcedureResolver(r),
+		zbaction.WithLogFormat(zbaction.LogFormatJSON),
+		zbaction.WithCustomStdout(stdout),
+		zbaction.WithCustomStderr(stderr),
+	)
+
+	assert.NoError(t, err)
+	assert.Equal(t,
+		`{"job":"build","step":"Print","stream":"stdout","message":"hello"}`+"\n"+
+			`{"job":"build","step":"Print","stream":"stdout","message":"wor"}`+"\n",
+		stdout.String())
+	assert.Equal(t, `{"job":"build","step":"Print","stream":"stderr","message":"oops"}`+"\n", stderr.String())
+}
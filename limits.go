@@ -0,0 +1,59 @@
+package zbaction
+
+import "time"
+
+// Resource is the kind of resources limited by ResourceLimits.
+type Resource = string
+
+const (
+	ResourceMemory    Resource = "memory"
+	ResourceCPUTime   Resource = "cpuTime"
+	ResourceOpenFiles Resource = "openFiles"
+	ResourceProcesses Resource = "processes"
+)
+
+// ResourceLimits are the limits of the resources a command can use.
+//
+// The zero value of each field means unlimited. A limit which can't be
+// enforced fails the command with ErrResourceLimitUnsupported, unless the
+// action runs with WithBestEffortResourceLimits.
+type ResourceLimits struct {
+	// MaxMemory is the maximum memory in bytes.
+	// It requires a delegated cgroup v2 with the memory controller.
+	MaxMemory int64
+	// MaxCPUTime is the maximum CPU time. It is rounded up to seconds,
+	// and must not exceed the hard limit of the current process.
+	MaxCPUTime time.Duration
+	// MaxOpenFiles is the maximum number of open files of each process,
+	// which must not exceed the hard limit of the current process.
+	MaxOpenFiles int64
+	// MaxProcesses is the maximum number of processes.
+	// It requires a delegated cgroup v2 with the pids controller.
+	MaxProcesses int64
+}
+
+// Narrow returns the limits where each resource is limited
+// by the smaller one of l and o.
+func (l ResourceLimits) Narrow(o ResourceLimits) ResourceLimits {
+	return ResourceLimits{
+		MaxMemory:    narrowLimit(l.MaxMemory, o.MaxMemory),
+		MaxCPUTime:   narrowLimit(l.MaxCPUTime, o.MaxCPUTime),
+		MaxOpenFiles: narrowLimit(l.MaxOpenFiles, o.MaxOpenFiles),
+		MaxProcesses: narrowLimit(l.MaxProcesses, o.MaxProcesses),
+	}
+}
+
+func (l ResourceLimits) IsZero() bool {
+	return l.MaxMemory == 0 && l.MaxCPUTime == 0 && l.MaxOpenFiles == 0 && l.MaxProcesses == 0
+}
+
+func narrowLimit[T int64 | time.Duration](a, b T) T {
+	if a <= 0 {
+		return b
+	}
+	if b <= 0 {
+		return a
+	}
+
+	return min(a, b)
+}
@@ -0,0 +1,366 @@
+package zbaction
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+const cgroupRoot = "/sys/fs/cgroup"
+
+// resourceLimiter applies ResourceLimits to a command.
+//
+// The memory and process limits are applied with a cgroup v2 created for
+// the command, so they cover the whole process tree. This requires the cgroup
+// of the current process to be delegated (see delegatedCgroup), as their
+// rlimits are per user (RLIMIT_NPROC) or break the runtimes reserving
+// a large address space (RLIMIT_AS).
+//
+// The CPU time and open files limits are applied with rlimits by running
+// the command through `sh -c 'ulimit ...; exec "$@"'`, so they are
+// in effect before the command starts.
+//
+// A limit which can't be enforced fails with ErrResourceLimitUnsupported,
+// or is only warned about if bestEffort is set.
+type resourceLimiter struct {
+	limits     ResourceLimits
+	bestEffort bool
+
+	// cgroup is the path of the cgroup created for the command.
+	cgroup     string
+	cgroupFile *os.File
+
+	cgroupMemory    bool
+	cgroupProcesses bool
+}
+
+func newResourceLimiter(cmd *exec.Cmd, limits ResourceLimits, bestEffort bool) (*resourceLimiter, error) {
+	l := &resourceLimiter{limits: limits, bestEffort: bestEffort}
+
+	if limits.MaxMemory > 0 || limits.MaxProcesses > 0 {
+		if err := l.setupCgroup(cmd); err != nil {
+			l.Close()
+			if !bestEffort {
+				return nil, err
+			}
+			slog.Warn("The memory and process limits are not enforced", slog.String("error", err.Error()))
+		}
+	}
+
+	if err := l.wrapWithRlimits(cmd); err != nil {
+		l.Close()
+		return nil, err
+	}
+
+	return l, nil
+}
+
+// wrapWithRlimits makes cmd set the CPU time and open files rlimits
+// with the `ulimit` of sh, and then exec the command.
+func (l *resourceLimiter) wrapWithRlimits(cmd *exec.Cmd) error {
+	var ulimits []string
+
+	if l.limits.MaxCPUTime > 0 {
+		seconds := uint64((l.limits.MaxCPUTime + time.Second - 1) / time.Second)
+		hard, err := l.clampRlimit(ResourceCPUTime, unix.RLIMIT_CPU, seconds+1)
+		if err != nil {
+			return err
+		}
+		// SIGXCPU on the soft limit, and SIGKILL a second later.
+		ulimits = append(ulimits,
+			"ulimit -t "+strconv.FormatUint(hard, 10),
+			"ulimit -S -t "+strconv.FormatUint(min(seconds, hard), 10))
+	}
+	if l.limits.MaxOpenFiles > 0 {
+		limit, err := l.clampRlimit(ResourceOpenFiles, unix.RLIMIT_NOFILE, uint64(l.limits.MaxOpenFiles))
+		if err != nil {
+			return err
+		}
+		ulimits = append(ulimits, "ulimit -n "+strconv.FormatUint(limit, 10))
+	}
+
+	if len(ulimits) == 0 || cmd.Err != nil {
+		return nil
+	}
+
+	sh, err := exec.LookPath("sh")
+	if err != nil {
+		return fmt.Errorf("find sh to apply the rlimits: %w", err)
+	}
+
+	script := strings.Join(ulimits, " && ") + ` && exec "$@"`
+	cmd.Args = append([]string{"sh", "-c", script, "sh", cmd.Path}, cmd.Args[1:]...)
+	cmd.Path = sh
+
+	return nil
+}
+
+// setupCgroup creates a cgroup with the memory and process limits,
+// and makes cmd start in it.
+func (l *resourceLimiter) setupCgroup(cmd *exec.Cmd) error {
+	resource := ResourceMemory
+	if l.limits.MaxMemory <= 0 {
+		resource = ResourceProcesses
+	}
+
+	parent, err := delegatedCgroup()
+	if err != nil {
+		return NewErrResourceLimitUnsupported(resource, err)
+	}
+
+	cgroup, err := os.MkdirTemp(parent, "zbaction-*")
+	if err != nil {
+		return NewErrResourceLimitUnsupported(resource, fmt.Errorf("create cgroup: %w", err))
+	}
+	l.cgroup = cgroup
+
+	controllers, err := os.ReadFile(filepath.Join(cgroup, "cgroup.controllers"))
+	if err != nil {
+		return NewErrResourceLimitUnsupported(resource, fmt.Errorf("read controllers: %w", err))
+	}
+	available := strings.Fields(string(controllers))
+
+	if l.limits.MaxMemory > 0 {
+		if !slices.Contains(available, "memory") {
+			return NewErrResourceLimitUnsupported(ResourceMemory, errors.New("the cgroup memory controller is not available"))
+		}
+		if err := writeCgroupFile(cgroup, "memory.max", strconv.FormatInt(l.limits.MaxMemory, 10)); err != nil {
+			return NewErrResourceLimitUnsupported(ResourceMemory, err)
+		}
+		// no swap, so exceeding the limit ends up with an OOM kill
+		_ = writeCgroupFile(cgroup, "memory.swap.max", "0")
+		l.cgroupMemory = true
+	}
+	if l.limits.MaxProcesses > 0 {
+		if !slices.Contains(available, "pids") {
+			return NewErrResourceLimitUnsupported(ResourceProcesses, errors.New("the cgroup pids controller is not available"))
+		}
+		if err := writeCgroupFile(cgroup, "pids.max", strconv.FormatInt(l.limits.MaxProcesses, 10)); err != nil {
+			return NewErrResourceLimitUnsupported(ResourceProcesses, err)
+		}
+		l.cgroupProcesses = true
+	}
+
+	l.cgroupFile, err = os.Open(cgroup)
+	if err != nil {
+		return NewErrResourceLimitUnsupported(resource, fmt.Errorf("open cgroup: %w", err))
+	}
+
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	cmd.SysProcAttr.UseCgroupFD = true
+	cmd.SysProcAttr.CgroupFD = int(l.cgroupFile.Fd())
+
+	return nil
+}
+
+// Started releases the cgroup held for starting the command.
+func (l *resourceLimiter) Started() {
+	if l.cgroupFile != nil {
+		_ = l.cgroupFile.Close()
+		l.cgroupFile = nil
+	}
+}
+
+// Exceeded reports which resource limit the exited command has exceeded.
+func (l *resourceLimiter) Exceeded(state *os.ProcessState) (Resource, bool) {
+	if l.cgroupMemory && readCgroupEvent(l.cgroup, "memory.events", "oom_kill") > 0 {
+		return ResourceMemory, true
+	}
+	if l.cgroupProcesses && readCgroupEvent(l.cgroup, "pids.events", "max") > 0 {
+		return ResourceProcesses, true
+	}
+
+	if l.limits.MaxCPUTime > 0 && state != nil {
+		if status, ok := state.Sys().(syscall.WaitStatus); ok && status.Signaled() {
+			switch status.Signal() {
+			case syscall.SIGXCPU:
+				return ResourceCPUTime, true
+			case syscall.SIGKILL:
+				if state.UserTime()+state.SystemTime() >= l.limits.MaxCPUTime {
+					return ResourceCPUTime, true
+				}
+			}
+		}
+	}
+
+	return "", false
+}
+
+// Close kills the processes remaining in the cgroup and removes it.
+func (l *resourceLimiter) Close() {
+	if l.cgroupFile != nil {
+		_ = l.cgroupFile.Close()
+		l.cgroupFile = nil
+	}
+	if l.cgroup == "" {
+		return
+	}
+
+	_ = writeCgroupFile(l.cgroup, "cgroup.kill", "1")
+	for i := 0; i < 20; i++ {
+		if err := os.Remove(l.cgroup); err == nil || errors.Is(err, os.ErrNotExist) {
+			break
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+
+	l.cgroup = ""
+	l.cgroupMemory = false
+	l.cgroupProcesses = false
+}
+
+// runnerCgroupName is the name of the leaf cgroup
+// the current process is moved into by delegatedCgroup.
+const runnerCgroupName = "zbaction-runner"
+
+var cgroupDelegation struct {
+	once   sync.Once
+	cgroup string
+	err    error
+}
+
+// delegatedCgroup returns the cgroup to create the cgroups of the commands in,
+// where the memory and pids controllers are enabled for its children.
+//
+// Under the "no internal processes" rule of cgroup v2, a cgroup with processes
+// can't enable the controllers for its children. So the current process is moved
+// once into the leaf cgroup zbaction-runner, a sibling of the cgroups of the
+// commands, before enabling the controllers in the cgroup it was in.
+// That cgroup must be delegated to the current process, and have no other processes.
+func delegatedCgroup() (string, error) {
+	cgroupDelegation.once.Do(func() {
+		cgroupDelegation.cgroup, cgroupDelegation.err = delegateCgroup()
+	})
+
+	return cgroupDelegation.cgroup, cgroupDelegation.err
+}
+
+func delegateCgroup() (string, error) {
+	if _, err := os.Stat(filepath.Join(cgroupRoot, "cgroup.controllers")); err != nil {
+		return "", fmt.Errorf("cgroup v2 is not mounted: %w", err)
+	}
+
+	current, err := currentCgroup()
+	if err != nil {
+		return "", fmt.Errorf("get current cgroup: %w", err)
+	}
+
+	parent := current
+	if filepath.Base(current) == runnerCgroupName {
+		parent = filepath.Dir(current)
+	} else {
+		runner := filepath.Join(current, runnerCgroupName)
+		if err := os.Mkdir(runner, 0o755); err != nil && !errors.Is(err, os.ErrExist) {
+			return "", fmt.Errorf("create runner cgroup: %w", err)
+		}
+		if err := writeCgroupFile(runner, "cgroup.procs", strconv.Itoa(os.Getpid())); err != nil {
+			return "", fmt.Errorf("move into runner cgroup: %w", err)
+		}
+	}
+
+	controllers, err := os.ReadFile(filepath.Join(parent, "cgroup.controllers"))
+	if err != nil {
+		return "", fmt.Errorf("read controllers: %w", err)
+	}
+
+	var enable []string
+	for _, controller := range strings.Fields(string(controllers)) {
+		if controller == "memory" || controller == "pids" {
+			enable = append(enable, "+"+controller)
+		}
+	}
+	if len(enable) == 0 {
+		return "", fmt.Errorf("the memory and pids controllers are not delegated to %s", parent)
+	}
+	if err := writeCgroupFile(parent, "cgroup.subtree_control", strings.Join(enable, " ")); err != nil {
+		return "", fmt.Errorf("enable controllers in %s, which may have other processes: %w", parent, err)
+	}
+
+	return parent, nil
+}
+
+// currentCgroup returns the path of the cgroup v2 of the current process.
+func currentCgroup() (string, error) {
+	f, err := os.Open("/proc/self/cgroup")
+	if err != nil {
+		return "", err
+	}
+	defer func() {
+		_ = f.Close()
+	}()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if p, ok := strings.CutPrefix(scanner.Text(), "0::"); ok {
+			return filepath.Join(cgroupRoot, p), nil
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return "", err
+	}
+
+	return "", errors.New("not in a cgroup v2")
+}
+
+func writeCgroupFile(cgroup string, name string, value string) error {
+	if err := os.WriteFile(filepath.Join(cgroup, name), []byte(value), 0644); err != nil {
+		return fmt.Errorf("write %s: %w", name, err)
+	}
+
+	return nil
+}
+
+// readCgroupEvent reads the counter of the event in a cgroup events file.
+func readCgroupEvent(cgroup string, name string, event string) int64 {
+	content, err := os.ReadFile(filepath.Join(cgroup, name))
+	if err != nil {
+		return 0
+	}
+
+	for _, line := range strings.Split(string(content), "\n") {
+		if key, value, ok := strings.Cut(line, " "); ok && key == event {
+			count, _ := strconv.ParseInt(value, 10, 64)
+			return count
+		}
+	}
+
+	return 0
+}
+
+// clampRlimit checks limit against the hard limit of the resource,
+// which the command inherits and can't raise.
+//
+// A limit above the hard limit is not enforced as requested, so it fails
+// unless the limits are best effort, where it is clamped to the hard limit.
+func (l *resourceLimiter) clampRlimit(resource Resource, rlimit int, limit uint64) (uint64, error) {
+	var current unix.Rlimit
+	if err := unix.Getrlimit(rlimit, &current); err != nil {
+		return 0, NewErrResourceLimitUnsupported(resource, err)
+	}
+	if limit <= current.Max {
+		return limit, nil
+	}
+
+	err := fmt.Errorf("%d exceeds the hard limit %d", limit, current.Max)
+	if !l.bestEffort {
+		return 0, NewErrResourceLimitUnsupported(resource, err)
+	}
+
+	slog.Warn("The resource limit is lowered to the hard limit",
+		slog.String("resource", resource), slog.String("error", err.Error()))
+	return current.Max, nil
+}
@@ -0,0 +1,33 @@
+//go:build !linux
+
+package zbaction
+
+import (
+	"errors"
+	"log/slog"
+	"os"
+	"os/exec"
+)
+
+// resourceLimiter only supports Linux.
+type resourceLimiter struct{}
+
+func newResourceLimiter(_ *exec.Cmd, limits ResourceLimits, bestEffort bool) (*resourceLimiter, error) {
+	if !limits.IsZero() {
+		err := errors.New("resource limits are only supported on Linux")
+		if !bestEffort {
+			return nil, err
+		}
+		slog.Warn("The resource limits are not enforced", slog.String("error", err.Error()))
+	}
+
+	return &resourceLimiter{}, nil
+}
+
+func (l *resourceLimiter) Started() {}
+
+func (l *resourceLimiter) Exceeded(*os.ProcessState) (Resource, bool) {
+	return "", false
+}
+
+func (l *resourceLimiter) Close() {}
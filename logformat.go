@@ -0,0 +1,188 @@
+package zbaction
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"sync"
+	"time"
+)
+
+// LogFormat is the format of the logs of the steps
+// written to the stdout and stderr of the action.
+type LogFormat string
+
+const (
+	// LogFormatRaw writes the logs as is.
+	LogFormatRaw LogFormat = "raw"
+	// LogFormatPrefixed prefixes each line with the job and step name,
+	// for example `[build/Install dependencies] added 42 packages`.
+	LogFormatPrefixed LogFormat = "prefixed"
+	// LogFormatJSON writes each line as a JSON object,
+	// with the job and step name and the stream it comes from.
+	LogFormatJSON LogFormat = "json"
+)
+
+// maxLogLineLength is the maximum length of a buffered line.
+// Longer lines are split, so a stream without newlines can't exhaust the memory.
+const maxLogLineLength = 64 << 10 // 64 KiB
+
+// LogOptions is the options of the log formatter.
+type LogOptions struct {
+	Format LogFormat
+	// Timestamps indicates whether to add the time of each line.
+	Timestamps bool
+}
+
+type logLine struct {
+	Time    string `json:"time,omitempty"`
+	Job     string `json:"job"`
+	Step    string `json:"step"`
+	Stream  string `json:"stream"`
+	Message string `json:"message"`
+}
+
+// logWriter buffers the stream by line and writes
+// each line to target in the specified format.
+type logWriter struct {
+	target  io.Writer
+	options LogOptions
+
+	job    string
+	step   string
+	stream string
+
+	now func() time.Time
+	buf []byte
+	mu  sync.Mutex
+}
+
+func newLogWriter(target io.Writer, options LogOptions, job string, step string, stream string) *logWriter {
+	return &logWriter{
+		target:  target,
+		options: options,
+		job:     job,
+		step:    step,
+		stream:  stream,
+		now:     time.Now,
+	}
+}
+
+func (w *logWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	for _, b := range p {
+		if b == '\n' {
+			if err := w.writeLine(); err != nil {
+				return 0, err
+			}
+			continue
+		}
+
+		w.buf = append(w.buf, b)
+		if len(w.buf) >= maxLogLineLength {
+			if err := w.writeLine(); err != nil {
+				return 0, err
+			}
+		}
+	}
+
+	return len(p), nil
+}
+
+// Flush writes the remaining incomplete line.
+func (w *logWriter) Flush() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if len(w.buf) == 0 {
+		return nil
+	}
+
+	return w.writeLine()
+}
+
+func (w *logWriter) writeLine() error {
+	line := w.format(string(w.buf))
+	w.buf = w.buf[:0]
+
+	_, err := w.target.Write(line)
+	return err
+}
+
+func (w *logWriter) format(message string) []byte {
+	timestamp := ""
+	if w.options.Timestamps {
+		timestamp = w.now().UTC().Format(time.RFC3339Nano)
+	}
+
+	switch w.options.Format {
+	case LogFormatJSON:
+		line, err := json.Marshal(logLine{
+			Time:    timestamp,
+			Job:     w.job,
+			Step:    w.step,
+			Stream:  w.stream,
+			Message: message,
+		})
+		if err == nil {
+			return append(line, '\n')
+		}
+	case LogFormatRaw, LogFormatPrefixed:
+	}
+
+	line := make([]byte, 0, len(timestamp)+len(w.job)+len(w.step)+len(message)+6)
+	if timestamp != "" {
+		line = append(line, timestamp...)
+		line = append(line, ' ')
+	}
+	if w.options.Format != LogFormatRaw {
+		line = append(line, '[')
+		line = append(line, w.job...)
+		line = append(line, '/')
+		line = append(line, w.step...)
+		line = append(line, "] "...)
+	}
+	line = append(line, message...)
+
+	return append(line, '\n')
+}
+
+// stepLogs formats the streams of a step. The writer of each stream
+// is created on its first use, and flushed when the step ends.
+type stepLogs struct {
+	writers map[string]*logWriter
+	mu      sync.Mutex
+}
+
+// writer gets the formatting writer of stream, which writes to target.
+func (l *stepLogs) writer(target io.Writer, options LogOptions, job string, step string, stream string) *logWriter {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if w, ok := l.writers[stream]; ok {
+		return w
+	}
+
+	if l.writers == nil {
+		l.writers = make(map[string]*logWriter)
+	}
+	w := newLogWriter(target, options, job, step, stream)
+	l.writers[stream] = w
+
+	return w
+}
+
+// Flush writes the remaining incomplete lines of the streams.
+func (l *stepLogs) Flush() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	var errs []error
+	for _, w := range l.writers {
+		errs = append(errs, w.Flush())
+	}
+
+	return errors.Join(errs...)
+}
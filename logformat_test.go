@@ -0,0 +1,40 @@
+package zbaction
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLogWriter_Prefixed(t *testing.T) {
+	buf := &bytes.Buffer{}
+	w := newLogWriter(buf, LogOptions{Format: LogFormatPrefixed}, "build", "Install", "stdout")
+
+	_, _ = w.Write([]byte("hello\nwor"))
+	assert.Equal(t, "[build/Install] hello\n", buf.String())
+
+	_, _ = w.Write([]byte("ld\nbye"))
+	assert.NoError(t, w.Flush())
+	assert.Equal(t, "[build/Install] hello\n[build/Install] world\n[build/Install] bye\n", buf.String())
+}
+
+func TestLogWriter_Timestamps(t *testing.T) {
+	buf := &bytes.Buffer{}
+	w := newLogWriter(buf, LogOptions{Format: LogFormatRaw, Timestamps: true}, "build", "Install", "stderr")
+	w.now = func() time.Time {
+		return time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	}
+
+	_, _ = w.Write([]byte("hello\n"))
+	assert.Equal(t, "2024-03-01T12:00:00Z hello\n", buf.String())
+}
+
+func TestLogWriter_JSON(t *testing.T) {
+	buf := &bytes.Buffer{}
+	w := newLogWriter(buf, LogOptions{Format: LogFormatJSON}, "build", "Install", "stderr")
+
+	_, _ = w.Write([]byte("\"quoted\"\n"))
+	assert.Equal(t, `{"job":"build","step":"Install","stream":"stderr","message":"\"quoted\""}`+"\n", buf.String())
+}
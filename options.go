@@ -5,6 +5,7 @@ import (
 	"maps"
 	"os"
 	"strings"
+	"time"
 )
 
 type ExecutorOptionsFn func(*ExecutorOptions)
@@ -12,8 +13,39 @@ type ExecutorOptions struct {
 	RuntimeVariables map[string]string
 	Stdout           io.Writer
 	Stderr           io.Writer
+	// OutputLimit is the number of bytes of stdout and stderr
+	// kept in memory as the output of a step.
+	OutputLimit int
+	// KillGracePeriod is the time to wait after sending SIGTERM to a
+	// cancelled command before killing it with SIGKILL.
+	KillGracePeriod time.Duration
+	// LogOptions is the format of the logs written to Stdout and Stderr.
+	LogOptions LogOptions
+	// ProcedureResolver resolves the procedures of ProcStep.
+	// By default, it is the global registry.
+	ProcedureResolver ProcedureStepResolver
+	// MaxActionDepth is the maximum depth of the actions nested with
+	// ActionStep, and of the composite procedures nested in each other,
+	// to prevent infinite recursion.
+	MaxActionDepth int
+	// LogDirectory is the directory of the log files of the streams
+	// exceeding OutputLimit. The executor never removes it.
+	LogDirectory string
+	// BestEffortResourceLimits runs the commands whose resource limits
+	// can't be enforced with a warning, instead of failing them.
+	BestEffortResourceLimits bool
+
+	// depth is the depth of the action to run. The root action is 0.
+	depth int
 }
 
+// DefaultMaxActionDepth is the default maximum depth of the nested actions.
+const DefaultMaxActionDepth = 8
+
+// DefaultKillGracePeriod is the default time to wait after sending SIGTERM
+// to a cancelled command before killing it with SIGKILL.
+const DefaultKillGracePeriod = 10 * time.Second
+
 // WithRuntimeVariables injects custom runtime variables into the action.
 //
 // Its behavior is similar to adding variables to the Variables of the action yourself,
@@ -62,3 +94,83 @@ func WithCustomStderr(w io.Writer) ExecutorOptionsFn {
 		o.Stderr = w
 	}
 }
+
+// WithOutputLimit sets the number of bytes of stdout and stderr
+// kept in memory as the output of a step.
+//
+// The streams exceeding the limit are spilled to a log file,
+// and only the head and the tail of them are kept in the output.
+func WithOutputLimit(limit int) ExecutorOptionsFn {
+	return func(o *ExecutorOptions) {
+		o.OutputLimit = limit
+	}
+}
+
+// WithKillGracePeriod sets the time to wait after sending SIGTERM
+// to a cancelled command before killing it with SIGKILL.
+//
+// The signals are sent to the process group of the command,
+// so the processes it started are terminated as well.
+func WithKillGracePeriod(d time.Duration) ExecutorOptionsFn {
+	return func(o *ExecutorOptions) {
+		o.KillGracePeriod = d
+	}
+}
+
+// WithBestEffortResourceLimits runs a command even if some of its
+// resource limits can't be enforced, for example without a delegated
+// cgroup v2, and logs a warning instead.
+//
+// By default, such a command fails with ErrResourceLimitUnsupported.
+func WithBestEffortResourceLimits() ExecutorOptionsFn {
+	return func(o *ExecutorOptions) {
+		o.BestEffortResourceLimits = true
+	}
+}
+
+// WithLogFormat sets the format of the logs written to the stdout and stderr.
+//
+// Except LogFormatRaw, the logs are buffered by line, so the lines
+// from the parallel jobs will not be interleaved.
+func WithLogFormat(format LogFormat) ExecutorOptionsFn {
+	return func(o *ExecutorOptions) {
+		o.LogOptions.Format = format
+	}
+}
+
+// WithLogTimestamps adds the time to each line of the logs.
+func WithLogTimestamps() ExecutorOptionsFn {
+	return func(o *ExecutorOptions) {
+		o.LogOptions.Timestamps = true
+	}
+}
+
+// WithProcedureResolver sets the resolver of the procedures in this action.
+//
+// To only swap some procedures, use a resolver layered on
+// the global registry (see NewProcedureStepResolverWithParent).
+func WithProcedureResolver(r ProcedureStepResolver) ExecutorOptionsFn {
+	return func(o *ExecutorOptions) {
+		o.ProcedureResolver = r
+	}
+}
+
+// WithMaxActionDepth sets the maximum depth of the actions nested with ActionStep,
+// which also limits the depth of the composite procedures nested in each other.
+func WithMaxActionDepth(depth int) ExecutorOptionsFn {
+	return func(o *ExecutorOptions) {
+		o.MaxActionDepth = depth
+	}
+}
+
+// WithLogDirectory keeps the log files of the streams exceeding
+// the output limit in dir, which is owned by the caller.
+//
+// The executor never removes dir, so the paths in the `<variable>File`
+// outputs stay valid after the action. Without a log directory, the log
+// files are kept in a temporary directory removed when the job cleans up.
+func WithLogDirectory(dir string) ExecutorOptionsFn {
+	return func(o *ExecutorOptions) {
+		o.LogDirectory = dir
+	}
+}
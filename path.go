@@ -0,0 +1,74 @@
+package zbaction
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ResolvePath resolves the path p relative to root.
+//
+// Absolute paths are also considered relative to root.
+// It returns ErrPathOutsideRoot if the resolved path escapes root.
+func ResolvePath(root string, p string) (string, error) {
+	resolved := filepath.Join(root, p)
+	if !isWithin(root, resolved) {
+		return "", NewErrPathOutsideRoot(p)
+	}
+
+	return resolved, nil
+}
+
+// isWithin reports whether the clean path p is root or inside root.
+func isWithin(root string, p string) bool {
+	rel, err := filepath.Rel(root, p)
+	if err != nil {
+		return false
+	}
+
+	return rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// ResolveRealPath resolves the path p relative to root like ResolvePath,
+// and follows the symlinks in the existing part of the resolved path.
+//
+// ResolvePath is purely lexical, so a symlink in root, such as one in
+// a checked out repository, may still point outside root. ResolveRealPath
+// returns ErrPathOutsideRoot in this case, and the resolved path with
+// the symlinks followed otherwise.
+func ResolveRealPath(root string, p string) (string, error) {
+	resolved, err := ResolvePath(root, p)
+	if err != nil {
+		return "", err
+	}
+
+	realRoot, err := filepath.EvalSymlinks(root)
+	if err != nil {
+		return "", err
+	}
+
+	// find the deepest existing ancestor of the path
+	existing, rest := resolved, ""
+	for {
+		realExisting, err := filepath.EvalSymlinks(existing)
+		if err == nil {
+			if !isWithin(realRoot, realExisting) {
+				return "", NewErrPathOutsideRoot(p)
+			}
+			return filepath.Join(realExisting, rest), nil
+		}
+		if !errors.Is(err, fs.ErrNotExist) {
+			return "", err
+		}
+
+		// a dangling symlink may be created through
+		if _, err := os.Lstat(existing); err == nil {
+			return "", NewErrPathOutsideRoot(p)
+		}
+
+		rest = filepath.Join(filepath.Base(existing), rest)
+		existing = filepath.Dir(existing)
+	}
+}
@@ -0,0 +1,76 @@
+package zbaction_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	zbaction "github.com/zeabur/action"
+)
+
+func TestResolvePath(t *testing.T) {
+	root := "/tmp/zbaction-root"
+
+	p, err := zbaction.ResolvePath(root, "")
+	assert.NoError(t, err)
+	assert.Equal(t, root, p)
+
+	p, err = zbaction.ResolvePath(root, "services/api")
+	assert.NoError(t, err)
+	assert.Equal(t, "/tmp/zbaction-root/services/api", p)
+
+	p, err = zbaction.ResolvePath(root, "/services/../web")
+	assert.NoError(t, err)
+	assert.Equal(t, "/tmp/zbaction-root/web", p)
+
+	p, err = zbaction.ResolvePath(root, "..foo")
+	assert.NoError(t, err)
+	assert.Equal(t, "/tmp/zbaction-root/..foo", p)
+}
+
+func TestResolvePath_Escape(t *testing.T) {
+	root := "/tmp/zbaction-root"
+
+	_, err := zbaction.ResolvePath(root, "..")
+	assert.ErrorAs(t, err, &zbaction.ErrPathOutsideRoot{})
+
+	_, err = zbaction.ResolvePath(root, "services/../../etc")
+	assert.ErrorAs(t, err, &zbaction.ErrPathOutsideRoot{})
+}
+
+func TestResolveRealPath(t *testing.T) {
+	root := t.TempDir()
+	outside := t.TempDir()
+
+	if err := os.Mkdir(filepath.Join(root, "inside"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	for name, target := range map[string]string{
+		"link":     "inside",
+		"out":      outside,
+		"dangling": filepath.Join(outside, "missing"),
+	} {
+		if err := os.Symlink(target, filepath.Join(root, name)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	realRoot, err := filepath.EvalSymlinks(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p, err := zbaction.ResolveRealPath(root, "link/new/file")
+	assert.NoError(t, err)
+	assert.Equal(t, filepath.Join(realRoot, "inside/new/file"), p)
+
+	p, err = zbaction.ResolveRealPath(root, "")
+	assert.NoError(t, err)
+	assert.Equal(t, realRoot, p)
+
+	for _, escaping := range []string{"..", "out", "out/new/file", "dangling", "dangling/file"} {
+		_, err := zbaction.ResolveRealPath(root, escaping)
+		assert.ErrorAs(t, err, &zbaction.ErrPathOutsideRoot{}, escaping)
+	}
+}
@@ -0,0 +1,85 @@
+package plugin
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"time"
+
+	zbaction "github.com/zeabur/action"
+)
+
+// DescribeTimeout is the time limit of describing each plugin in Discover.
+var DescribeTimeout = 10 * time.Second
+
+// Discover registers the plugin executables in dir to the resolver.
+//
+// Each executable is described to get its schema. The procedure is registered
+// with the name in the schema, or the file name if the schema has no name.
+// The plugins failing to be described within DescribeTimeout, or providing
+// a procedure already provided by another plugin, are skipped with a warning.
+func Discover(ctx context.Context, dir string, r zbaction.ProcedureStepResolver) error {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return fmt.Errorf("read plugin directory: %w", err)
+	}
+
+	registered := make(map[zbaction.ProcStepName]string)
+
+	for _, entry := range entries {
+		path := filepath.Join(dir, entry.Name())
+
+		// follow the symlinks
+		info, err := os.Stat(path)
+		if err != nil {
+			slog.Warn("Skipping the plugin", slog.String("path", path), slog.String("error", err.Error()))
+			continue
+		}
+		if !info.Mode().IsRegular() || info.Mode().Perm()&0o111 == 0 {
+			continue
+		}
+
+		p := Plugin{Path: path}
+
+		describeCtx, cancel := context.WithTimeout(ctx, DescribeTimeout)
+		schema, err := p.Describe(describeCtx)
+		cancel()
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if err != nil {
+			slog.Warn("Skipping the plugin", slog.String("path", path), slog.String("error", err.Error()))
+			continue
+		}
+
+		name := schema.Name
+		if name == "" {
+			name = entry.Name()
+		}
+
+		if conflicted, ok := registered[name]; ok {
+			slog.Warn("Skipping the plugin providing a registered procedure",
+				slog.String("path", path), slog.String("procedure", name), slog.String("registered", conflicted))
+			continue
+		}
+		registered[name] = path
+
+		r.RegisterWithSchema(name, schema.ProcedureSchema(), p.Builder())
+	}
+
+	return nil
+}
+
+// NewDirectoryResolver creates a resolver with the plugins in dir,
+// layered on the parent. See Discover for how the plugins are registered.
+func NewDirectoryResolver(ctx context.Context, dir string, parent zbaction.ProcedureStepResolver) (zbaction.ProcedureStepResolver, error) {
+	r := zbaction.NewProcedureStepResolverWithParent(parent)
+
+	if err := Discover(ctx, dir, r); err != nil {
+		return nil, err
+	}
+
+	return r, nil
+}
@@ -0,0 +1,219 @@
+package plugin
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"time"
+
+	zbaction "github.com/zeabur/action"
+)
+
+// waitDelay is the time to wait for the plugin to exit
+// after it is killed or has sent the result.
+const waitDelay = 5 * time.Second
+
+// inheritedEnvironment is the environment variables of the host
+// passed to the plugin. The variables of the step are sent in the request.
+var inheritedEnvironment = []string{"PATH", "HOME", "TMPDIR"}
+
+// Plugin is a plugin executable.
+type Plugin struct {
+	// Path is the path to the executable.
+	Path string
+}
+
+// Describe asks the plugin for the schema of its procedure.
+func (p Plugin) Describe(ctx context.Context) (Schema, error) {
+	var schema *Schema
+
+	err := p.call(ctx, "", Request{
+		Version: ProtocolVersion,
+		Method:  MethodDescribe,
+		Run:     nil,
+	}, io.Discard, func(m Message) error {
+		if m.Type == MessageTypeSchema {
+			schema = m.Schema
+		}
+		return nil
+	})
+	if err != nil {
+		return Schema{}, fmt.Errorf("describe %s: %w", p.Path, err)
+	}
+	if schema == nil {
+		return Schema{}, fmt.Errorf("describe %s: no schema returned", p.Path)
+	}
+
+	return *schema, nil
+}
+
+// Builder gets the builder of the procedure the plugin provides.
+func (p Plugin) Builder() zbaction.ProcedureStepBuilder {
+	return func(args zbaction.ProcStepArgs) (zbaction.ProcedureStep, error) {
+		return &pluginStep{
+			plugin: p,
+			with:   args,
+		}, nil
+	}
+}
+
+type pluginStep struct {
+	plugin Plugin
+	with   zbaction.ProcStepArgs
+}
+
+func (s *pluginStep) Run(ctx context.Context, sc *zbaction.StepContext) (zbaction.CleanupFn, error) {
+	workingDirectory, err := sc.WorkingDirectory()
+	if err != nil {
+		return nil, err
+	}
+
+	with := make(map[string]string, len(s.with))
+	for key, value := range s.with {
+		with[key] = sc.ExpandString(value)
+	}
+
+	variableContainer := sc.VariableContainer()
+	variables := make(map[string]string)
+	for key := range variableContainer.ListRawVariables() {
+		if value, ok := variableContainer.GetVariable(key); ok {
+			variables[key] = value
+		}
+	}
+
+	stdout := zbaction.NewContextWriter(sc, "stdout", sc.Stdout())
+	stderr := zbaction.NewContextWriter(sc, "stderr", sc.Stderr())
+
+	err = s.plugin.call(ctx, workingDirectory, Request{
+		Version: ProtocolVersion,
+		Method:  MethodRun,
+		Run: &RunRequest{
+			With:             with,
+			Root:             sc.Root(),
+			WorkingDirectory: workingDirectory,
+			Variables:        variables,
+		},
+	}, stderr, func(m Message) error {
+		switch m.Type {
+		case MessageTypeLog:
+			w := stdout
+			if m.Stream == "stderr" {
+				w = stderr
+			}
+			_, err := io.WriteString(w, m.Data)
+			return err
+		case MessageTypeOutput:
+			sc.SetThisOutput(m.Key, m.Value)
+		}
+		return nil
+	})
+
+	if closeErr := errors.Join(stdout.Close(), stderr.Close()); closeErr != nil && err == nil {
+		err = fmt.Errorf("close output: %w", closeErr)
+	}
+
+	return nil, err
+}
+
+// call sends the request to a new process of the plugin,
+// and passes the messages before the result to handle.
+func (p Plugin) call(ctx context.Context, dir string, req Request, stderr io.Writer, handle func(Message) error) error {
+	input, err := json.Marshal(req)
+	if err != nil {
+		return fmt.Errorf("marshal request: %w", err)
+	}
+
+	// the plugin is killed if the protocol is broken or it does not exit
+	// after the result, as it may be blocked on writing to stdout.
+	callCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	cmd := exec.CommandContext(callCtx, p.Path)
+	cmd.Dir = dir
+	cmd.Env = pluginEnvironment()
+	cmd.Stdin = bytes.NewReader(append(input, '\n'))
+	cmd.Stderr = stderr
+	cmd.WaitDelay = waitDelay
+
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return fmt.Errorf("open stdout: %w", err)
+	}
+
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("start plugin: %w", err)
+	}
+
+	var result *Message
+	var protocolErr error
+
+	decoder := json.NewDecoder(stdout)
+	for {
+		var m Message
+		if err := decoder.Decode(&m); err != nil {
+			if !errors.Is(err, io.EOF) {
+				protocolErr = fmt.Errorf("decode message: %w", err)
+			}
+			break
+		}
+
+		if err := checkVersion(m.Version); err != nil {
+			protocolErr = fmt.Errorf("plugin: %w", err)
+			break
+		}
+
+		if m.Type == MessageTypeResult {
+			result = &m
+			break
+		}
+
+		if err := handle(m); err != nil {
+			protocolErr = fmt.Errorf("handle %s message: %w", m.Type, err)
+			break
+		}
+	}
+
+	switch {
+	case protocolErr != nil:
+		cancel()
+	case result != nil:
+		// the plugin should exit after the result
+		timer := time.AfterFunc(waitDelay, cancel)
+		defer timer.Stop()
+	}
+	waitErr := cmd.Wait()
+
+	switch {
+	case ctx.Err() != nil:
+		return fmt.Errorf("plugin cancelled: %w", ctx.Err())
+	case protocolErr != nil:
+		return protocolErr
+	case result == nil && waitErr != nil:
+		return fmt.Errorf("plugin exited without result: %w", waitErr)
+	case result == nil:
+		return errors.New("plugin exited without result")
+	case result.Error != "":
+		return fmt.Errorf("plugin failed: %s", result.Error)
+	case waitErr != nil:
+		return fmt.Errorf("plugin exited: %w", waitErr)
+	}
+
+	return nil
+}
+
+// pluginEnvironment gets the environment of a plugin process.
+func pluginEnvironment() []string {
+	env := make([]string, 0, len(inheritedEnvironment))
+	for _, key := range inheritedEnvironment {
+		if value, ok := os.LookupEnv(key); ok {
+			env = append(env, key+"="+value)
+		}
+	}
+
+	return env
+}
@@ -0,0 +1,245 @@
+package plugin_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	zbaction "github.com/zeabur/action"
+	"github.com/zeabur/action/plugin"
+)
+
+// TestMain serves the test binary as a plugin
+// if ZBACTION_TEST_PLUGIN is set.
+func TestMain(m *testing.M) {
+	if os.Getenv("ZBACTION_TEST_PLUGIN") != "" {
+		err := plugin.Serve(context.Background(), plugin.Schema{
+			Name:        "test/greet",
+			Description: "Greet someone.",
+			Arguments: []plugin.Argument{
+				{Name: "name", Required: true},
+				{Name: "fail", Type: zbaction.ArgumentTypeBool, Default: "false"},
+				{Name: "garbage", Type: zbaction.ArgumentTypeBool, Default: "false"},
+			},
+			Outputs: []plugin.Output{{Name: "greeting"}, {Name: "secret"}},
+		}, func(ctx context.Context, req plugin.RunRequest, w *plugin.ResponseWriter) error {
+			if req.With["fail"] == "true" {
+				return errors.New("asked to fail")
+			}
+			if req.With["garbage"] == "true" {
+				// break the protocol, and hang
+				fmt.Println("not a message")
+				time.Sleep(time.Minute)
+			}
+			if err := w.SetOutput("secret", os.Getenv("ZBACTION_TEST_SECRET")); err != nil {
+				return err
+			}
+
+			wd, _ := os.Getwd()
+			greeting := fmt.Sprintf("Hello, %s!", req.With["name"])
+			_, _ = fmt.Fprintf(w.Stdout(), "%s (%t, %s)\n", greeting, wd == req.WorkingDirectory, req.Variables["who"])
+			return w.SetOutput("greeting", greeting)
+		})
+		if err != nil {
+			os.Exit(1)
+		}
+		os.Exit(0)
+	}
+
+	os.Exit(m.Run())
+}
+
+func newPluginDirectory(t *testing.T) string {
+	executable, err := os.Executable()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dir := t.TempDir()
+	script := fmt.Sprintf("#!/bin/sh\nZBACTION_TEST_PLUGIN=1 exec %q\n", executable)
+	if err := os.WriteFile(filepath.Join(dir, "greet"), []byte(script), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "README"), []byte("not a plugin"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	return dir
+}
+
+func TestDiscover(t *testing.T) {
+	r, err := plugin.NewDirectoryResolver(context.Background(), newPluginDirectory(t), zbaction.NewProcedureStepResolver())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, []zbaction.ProcStepName{"test/greet"}, r.List())
+
+	schema, ok := r.Describe("test/greet")
+	if !ok {
+		t.Fatal("test/greet is not registered")
+	}
+	assert.Equal(t, "Greet someone.", schema.Description)
+	assert.Equal(t, zbaction.OutputSchema{Name: "greeting"}, schema.Outputs[0])
+}
+
+func TestDiscover_SkipBrokenPlugins(t *testing.T) {
+	oldTimeout := plugin.DescribeTimeout
+	plugin.DescribeTimeout = 500 * time.Millisecond
+	defer func() {
+		plugin.DescribeTimeout = oldTimeout
+	}()
+
+	dir := newPluginDirectory(t)
+	for name, script := range map[string]string{
+		"broken": "#!/bin/sh\nexit 1\n",
+		"hang":   "#!/bin/sh\nexec sleep 60\n",
+	} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(script), 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	startedAt := time.Now()
+	r, err := plugin.NewDirectoryResolver(context.Background(), dir, zbaction.NewProcedureStepResolver())
+
+	assert.NoError(t, err)
+	assert.Equal(t, []zbaction.ProcStepName{"test/greet"}, r.List())
+	assert.Less(t, time.Since(startedAt), 5*time.Second)
+}
+
+func TestProtocolVersion(t *testing.T) {
+	// the plugin rejects a host speaking another version
+	out := &bytes.Buffer{}
+	err := plugin.ServeIO(context.Background(), strings.NewReader(`{"version":2,"method":"describe"}`+"\n"), out,
+		plugin.Schema{Name: "test/greet"}, nil)
+
+	assert.ErrorContains(t, err, "unsupported protocol version 2")
+	assert.Equal(t, `{"version":1,"type":"result","error":"unsupported protocol version 2, expected 1"}`+"\n", out.String())
+
+	// the host rejects a plugin speaking another version
+	path := filepath.Join(t.TempDir(), "future")
+	script := "#!/bin/sh\necho '{\"version\":2,\"type\":\"schema\",\"schema\":{\"name\":\"test/future\"}}'\n"
+	if err := os.WriteFile(path, []byte(script), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = plugin.Plugin{Path: path}.Describe(context.Background())
+	assert.ErrorContains(t, err, "unsupported protocol version 2")
+}
+
+func TestPluginStep(t *testing.T) {
+	r, err := plugin.NewDirectoryResolver(context.Background(), newPluginDirectory(t), zbaction.NewProcedureStepResolver())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stdout := &bytes.Buffer{}
+
+	err = zbaction.RunAction(context.Background(), zbaction.Action{
+		Variables: map[string]string{"who": "world"},
+		Jobs: []zbaction.Job{
+			{
+				Steps: []zbaction.Step{
+					{
+						ID: "greet",
+						RunnableStep: zbaction.ProcStep{
+							Uses: "test/greet",
+							With: zbaction.ProcStepArgs{"name": "${who}"},
+						},
+					},
+					{
+						RunnableStep: zbaction.CommandStep{
+							Command: []string{"echo", "${out.greet.greeting}"},
+						},
+					},
+				},
+			},
+		},
+	}, zbaction.WithProcedureResolver(r), zbaction.WithCustomStdout(stdout))
+
+	assert.NoError(t, err)
+	assert.Equal(t, "Hello, world! (true, world)\nHello, world!\n", stdout.String())
+
+	err = zbaction.RunAction(context.Background(), zbaction.Action{
+		Jobs: []zbaction.Job{
+			{
+				Steps: []zbaction.Step{
+					{
+						RunnableStep: zbaction.ProcStep{
+							Uses: "test/greet",
+							With: zbaction.ProcStepArgs{"name": "world", "fail": "true"},
+						},
+					},
+				},
+			},
+		},
+	}, zbaction.WithProcedureResolver(r))
+
+	assert.ErrorContains(t, err, "asked to fail")
+}
+
+func TestPluginStep_Environment(t *testing.T) {
+	t.Setenv("ZBACTION_TEST_SECRET", "p@ssw0rd")
+
+	r, err := plugin.NewDirectoryResolver(context.Background(), newPluginDirectory(t), zbaction.NewProcedureStepResolver())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	result, err := zbaction.RunActionWithResult(context.Background(), zbaction.Action{
+		Jobs: []zbaction.Job{
+			{
+				Steps: []zbaction.Step{
+					{
+						ID: "greet",
+						RunnableStep: zbaction.ProcStep{
+							Uses: "test/greet",
+							With: zbaction.ProcStepArgs{"name": "world"},
+						},
+					},
+				},
+			},
+		},
+	}, zbaction.WithProcedureResolver(r), zbaction.WithCustomStdout(&bytes.Buffer{}))
+
+	assert.NoError(t, err)
+
+	// the environment of the host is not inherited
+	secret, _ := result.GetOutput("greet", "secret")
+	assert.Equal(t, "", secret)
+}
+
+func TestPluginStep_ProtocolError(t *testing.T) {
+	r, err := plugin.NewDirectoryResolver(context.Background(), newPluginDirectory(t), zbaction.NewProcedureStepResolver())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	startedAt := time.Now()
+	err = zbaction.RunAction(context.Background(), zbaction.Action{
+		Jobs: []zbaction.Job{
+			{
+				Steps: []zbaction.Step{
+					{
+						RunnableStep: zbaction.ProcStep{
+							Uses: "test/greet",
+							With: zbaction.ProcStepArgs{"name": "world", "garbage": "true"},
+						},
+					},
+				},
+			},
+		},
+	}, zbaction.WithProcedureResolver(r))
+
+	assert.ErrorContains(t, err, "decode message")
+	// the hanging plugin is killed instead of waited for
+	assert.Less(t, time.Since(startedAt), 10*time.Second)
+}
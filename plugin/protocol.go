@@ -0,0 +1,148 @@
+// Package plugin runs procedures out of process.
+//
+// A plugin is an executable speaking JSON lines over stdio. The host writes
+// a single Request to the stdin of the plugin, and the plugin writes
+// Message's to its stdout until the final MessageTypeResult. Anything the
+// plugin writes to its stderr is forwarded to the stderr of the step.
+// The plugin only inherits PATH, HOME and TMPDIR from the environment
+// of the host, and gets the variables of the step in the request.
+//
+// Both the request and the messages carry the ProtocolVersion of their
+// sender, and a call fails if the versions of the host and the plugin differ.
+//
+// A "describe" call is answered with a MessageTypeSchema, and a "run" call
+// streams MessageTypeLog and MessageTypeOutput before the result.
+package plugin
+
+import (
+	"fmt"
+	"slices"
+
+	zbaction "github.com/zeabur/action"
+)
+
+// ProtocolVersion is the version of the protocol the host speaks.
+const ProtocolVersion = 1
+
+type Method string
+
+const (
+	MethodDescribe Method = "describe"
+	MethodRun      Method = "run"
+)
+
+// Request is a call from the host to the plugin.
+type Request struct {
+	Version int    `json:"version"`
+	Method  Method `json:"method"`
+	// Run is the payload of MethodRun.
+	Run *RunRequest `json:"run,omitempty"`
+}
+
+// RunRequest is the payload of MethodRun.
+type RunRequest struct {
+	// With is the arguments of the step, with the variables expanded.
+	With map[string]string `json:"with"`
+	// Root is the absolute path of the workspace root.
+	Root string `json:"root"`
+	// WorkingDirectory is the absolute working directory of the step.
+	// It is also the working directory of the plugin process.
+	WorkingDirectory string `json:"workingDirectory"`
+	// Variables is the variables visible to the step, expanded.
+	Variables map[string]string `json:"variables"`
+}
+
+type MessageType string
+
+const (
+	MessageTypeSchema MessageType = "schema"
+	MessageTypeLog    MessageType = "log"
+	MessageTypeOutput MessageType = "output"
+	MessageTypeResult MessageType = "result"
+)
+
+// Message is a message from the plugin to the host.
+type Message struct {
+	// Version is the version of the protocol the plugin speaks.
+	Version int         `json:"version"`
+	Type    MessageType `json:"type"`
+
+	// Schema is the payload of MessageTypeSchema.
+	Schema *Schema `json:"schema,omitempty"`
+
+	// Stream is "stdout" or "stderr" for MessageTypeLog.
+	Stream string `json:"stream,omitempty"`
+	// Data is the log content of MessageTypeLog.
+	Data string `json:"data,omitempty"`
+
+	// Key and Value are the output of MessageTypeOutput.
+	Key   string `json:"key,omitempty"`
+	Value string `json:"value,omitempty"`
+
+	// Error is the error message of MessageTypeResult. Empty means success.
+	Error string `json:"error,omitempty"`
+}
+
+// Schema describes the procedure a plugin provides.
+type Schema struct {
+	// Name is the name to register the procedure with,
+	// such as "acme/deploy@1.0.0".
+	Name        zbaction.ProcStepName `json:"name"`
+	Description string                `json:"description,omitempty"`
+	Arguments   []Argument            `json:"arguments,omitempty"`
+	Outputs     []Output              `json:"outputs,omitempty"`
+	Deprecated  string                `json:"deprecated,omitempty"`
+}
+
+type Argument struct {
+	Name        string                `json:"name"`
+	Type        zbaction.ArgumentType `json:"type,omitempty"`
+	Required    bool                  `json:"required,omitempty"`
+	Default     string                `json:"default,omitempty"`
+	Enum        []string              `json:"enum,omitempty"`
+	Description string                `json:"description,omitempty"`
+}
+
+type Output struct {
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+}
+
+// checkVersion checks if the other side speaks ProtocolVersion.
+func checkVersion(version int) error {
+	if version != ProtocolVersion {
+		return fmt.Errorf("unsupported protocol version %d, expected %d", version, ProtocolVersion)
+	}
+
+	return nil
+}
+
+// ProcedureSchema converts the schema to the one registered to the resolver.
+func (s Schema) ProcedureSchema() *zbaction.ProcedureSchema {
+	schema := &zbaction.ProcedureSchema{
+		Description: s.Description,
+		Arguments:   make([]zbaction.ArgumentSchema, 0, len(s.Arguments)),
+		Outputs:     make([]zbaction.OutputSchema, 0, len(s.Outputs)),
+		Examples:    nil,
+		Deprecated:  s.Deprecated,
+	}
+
+	for _, argument := range s.Arguments {
+		schema.Arguments = append(schema.Arguments, zbaction.ArgumentSchema{
+			Name:        argument.Name,
+			Type:        argument.Type,
+			Required:    argument.Required,
+			Default:     argument.Default,
+			Enum:        slices.Clone(argument.Enum),
+			Description: argument.Description,
+		})
+	}
+	for _, output := range s.Outputs {
+		schema.Outputs = append(schema.Outputs, zbaction.OutputSchema{
+			Name:        output.Name,
+			Description: output.Description,
+		})
+	}
+
+	return schema
+}
@@ -0,0 +1,102 @@
+package plugin
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+)
+
+// Handler runs the procedure of a plugin.
+type Handler func(ctx context.Context, req RunRequest, w *ResponseWriter) error
+
+// ResponseWriter sends the logs and outputs of a run call to the host.
+// It is safe for concurrent use.
+type ResponseWriter struct {
+	encoder *json.Encoder
+	mutex   sync.Mutex
+}
+
+func (w *ResponseWriter) send(m Message) error {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	m.Version = ProtocolVersion
+	return w.encoder.Encode(m)
+}
+
+// SetOutput sets an output of the step.
+func (w *ResponseWriter) SetOutput(key, value string) error {
+	return w.send(Message{Type: MessageTypeOutput, Key: key, Value: value})
+}
+
+// Stdout gets the writer to the stdout of the step.
+func (w *ResponseWriter) Stdout() io.Writer {
+	return logWriter{w: w, stream: "stdout"}
+}
+
+// Stderr gets the writer to the stderr of the step.
+func (w *ResponseWriter) Stderr() io.Writer {
+	return logWriter{w: w, stream: "stderr"}
+}
+
+type logWriter struct {
+	w      *ResponseWriter
+	stream string
+}
+
+func (l logWriter) Write(p []byte) (int, error) {
+	if err := l.w.send(Message{Type: MessageTypeLog, Stream: l.stream, Data: string(p)}); err != nil {
+		return 0, err
+	}
+
+	return len(p), nil
+}
+
+// Serve answers the call from the host on stdin and stdout.
+// It is meant to be called in the main function of a plugin.
+func Serve(ctx context.Context, schema Schema, handler Handler) error {
+	return ServeIO(ctx, os.Stdin, os.Stdout, schema, handler)
+}
+
+// ServeIO is Serve with the custom input and output.
+func ServeIO(ctx context.Context, in io.Reader, out io.Writer, schema Schema, handler Handler) error {
+	line, err := bufio.NewReader(in).ReadBytes('\n')
+	if err != nil && len(line) == 0 {
+		return fmt.Errorf("read request: %w", err)
+	}
+
+	var req Request
+	if err := json.Unmarshal(line, &req); err != nil {
+		return fmt.Errorf("unmarshal request: %w", err)
+	}
+
+	w := &ResponseWriter{encoder: json.NewEncoder(out)}
+
+	if err := checkVersion(req.Version); err != nil {
+		return errors.Join(err, w.send(Message{Type: MessageTypeResult, Error: err.Error()}))
+	}
+
+	switch req.Method {
+	case MethodDescribe:
+		if err := w.send(Message{Type: MessageTypeSchema, Schema: &schema}); err != nil {
+			return err
+		}
+		return w.send(Message{Type: MessageTypeResult})
+	case MethodRun:
+		if req.Run == nil {
+			return w.send(Message{Type: MessageTypeResult, Error: "no run payload"})
+		}
+
+		if err := handler(ctx, *req.Run, w); err != nil {
+			return w.send(Message{Type: MessageTypeResult, Error: err.Error()})
+		}
+		return w.send(Message{Type: MessageTypeResult})
+	default:
+		return w.send(Message{Type: MessageTypeResult, Error: fmt.Sprintf("unknown method %q", req.Method)})
+	}
+}
@@ -0,0 +1,203 @@
+// Package procdocs renders the reference documentation of the procedures
+// registered in a zbaction.ProcedureStepResolver.
+package procdocs
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+
+	zbaction "github.com/zeabur/action"
+)
+
+// Procedure is the documentation of a procedure.
+type Procedure struct {
+	Name        zbaction.ProcStepName `json:"name"`
+	Description string                `json:"description,omitempty"`
+	Deprecated  string                `json:"deprecated,omitempty"`
+	Arguments   []Argument            `json:"arguments"`
+	Outputs     []Output              `json:"outputs"`
+	Examples    []Example             `json:"examples"`
+}
+
+type Argument struct {
+	Name        string   `json:"name"`
+	Type        string   `json:"type"`
+	Required    bool     `json:"required"`
+	Default     string   `json:"default,omitempty"`
+	Enum        []string `json:"enum,omitempty"`
+	Description string   `json:"description,omitempty"`
+}
+
+type Output struct {
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+}
+
+type Example struct {
+	Description string                `json:"description,omitempty"`
+	Uses        zbaction.ProcStepName `json:"uses"`
+	With        zbaction.ProcStepArgs `json:"with"`
+}
+
+// Collect collects the documentation of every procedure in the resolver.
+func Collect(resolver zbaction.ProcedureStepResolver) []Procedure {
+	names := resolver.List()
+	procedures := make([]Procedure, 0, len(names))
+
+	for _, name := range names {
+		schema, ok := resolver.Describe(name)
+		if !ok {
+			continue
+		}
+
+		procedure := Procedure{
+			Name:      name,
+			Arguments: []Argument{},
+			Outputs:   []Output{},
+			Examples:  []Example{},
+		}
+		if schema == nil {
+			procedures = append(procedures, procedure)
+			continue
+		}
+
+		procedure.Description = schema.Description
+		procedure.Deprecated = schema.Deprecated
+		for _, argument := range schema.Arguments {
+			argumentType := string(argument.Type)
+			if argumentType == "" {
+				argumentType = string(zbaction.ArgumentTypeString)
+			}
+
+			procedure.Arguments = append(procedure.Arguments, Argument{
+				Name:        argument.Name,
+				Type:        argumentType,
+				Required:    argument.Required,
+				Default:     argument.Default,
+				Enum:        argument.Enum,
+				Description: argument.Description,
+			})
+		}
+		for _, output := range schema.Outputs {
+			procedure.Outputs = append(procedure.Outputs, Output{
+				Name:        output.Name,
+				Description: output.Description,
+			})
+		}
+		for _, example := range schema.Examples {
+			procedure.Examples = append(procedure.Examples, Example{
+				Description: example.Description,
+				Uses:        name,
+				With:        example.With,
+			})
+		}
+
+		procedures = append(procedures, procedure)
+	}
+
+	return procedures
+}
+
+// RenderJSON renders the documentation of the procedures as JSON.
+func RenderJSON(w io.Writer, resolver zbaction.ProcedureStepResolver) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+
+	return encoder.Encode(Collect(resolver))
+}
+
+// RenderMarkdown renders the documentation of the procedures as Markdown.
+func RenderMarkdown(w io.Writer, resolver zbaction.ProcedureStepResolver) error {
+	sb := strings.Builder{}
+
+	sb.WriteString("# Procedures\n")
+
+	for _, procedure := range Collect(resolver) {
+		sb.WriteString("\n## `" + procedure.Name + "`\n")
+		if procedure.Description != "" {
+			sb.WriteString("\n" + procedure.Description + "\n")
+		}
+		if procedure.Deprecated != "" {
+			sb.WriteString("\n> **Deprecated:** " + procedure.Deprecated + "\n")
+		}
+
+		if len(procedure.Arguments) > 0 {
+			sb.WriteString("\n### Arguments\n\n")
+			sb.WriteString("| Name | Type | Required | Default | Description |\n")
+			sb.WriteString("| --- | --- | --- | --- | --- |\n")
+
+			for _, argument := range procedure.Arguments {
+				required := "no"
+				if argument.Required {
+					required = "yes"
+				}
+
+				description := argument.Description
+				if len(argument.Enum) > 0 {
+					description = strings.TrimSpace(description + " One of " + codeList(argument.Enum) + ".")
+				}
+
+				defaultValue := ""
+				if argument.Default != "" {
+					defaultValue = code(argument.Default)
+				}
+
+				sb.WriteString(fmt.Sprintf("| %s | %s | %s | %s | %s |\n",
+					code(argument.Name), argument.Type, required, defaultValue, tableCell(description)))
+			}
+		}
+
+		if len(procedure.Outputs) > 0 {
+			sb.WriteString("\n### Outputs\n\n")
+			sb.WriteString("| Name | Description |\n")
+			sb.WriteString("| --- | --- |\n")
+
+			for _, output := range procedure.Outputs {
+				sb.WriteString(fmt.Sprintf("| %s | %s |\n", code(output.Name), tableCell(output.Description)))
+			}
+		}
+
+		if len(procedure.Examples) > 0 {
+			sb.WriteString("\n### Examples\n")
+
+			for _, example := range procedure.Examples {
+				step, err := json.MarshalIndent(map[string]any{
+					"uses": example.Uses,
+					"with": example.With,
+				}, "", "  ")
+				if err != nil {
+					return fmt.Errorf("marshal example of %s: %w", procedure.Name, err)
+				}
+
+				if example.Description != "" {
+					sb.WriteString("\n" + example.Description + "\n")
+				}
+				sb.WriteString("\n```json\n" + string(step) + "\n```\n")
+			}
+		}
+	}
+
+	_, err := io.WriteString(w, sb.String())
+	return err
+}
+
+func tableCell(s string) string {
+	s = strings.ReplaceAll(s, "|", "\\|")
+	return strings.ReplaceAll(s, "\n", "<br>")
+}
+
+func code(s string) string {
+	s = strings.ReplaceAll(s, "\n", "\\n")
+	return "`" + strings.ReplaceAll(s, "|", "\\|") + "`"
+}
+
+func codeList(values []string) string {
+	codes := make([]string, len(values))
+	for i, v := range values {
+		codes[i] = code(v)
+	}
+
+	return strings.Join(codes, ", ")
+}
@@ -0,0 +1,71 @@
+package procdocs_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	zbaction "github.com/zeabur/action"
+	"github.com/zeabur/action/procdocs"
+)
+
+func newTestResolver() zbaction.ProcedureStepResolver {
+	resolver := zbaction.NewProcedureStepResolver()
+
+	resolver.RegisterWithSchema("test/greet", &zbaction.ProcedureSchema{
+		Description: "Greet someone.",
+		Arguments: []zbaction.ArgumentSchema{
+			{Name: "name", Required: true, Description: "Who to greet."},
+			{Name: "style", Default: "polite", Enum: []string{"polite", "casual"}},
+		},
+		Outputs: []zbaction.OutputSchema{
+			{Name: "greeting", Description: "The greeting | message."},
+		},
+		Examples: []zbaction.ProcedureExample{
+			{Description: "Greet the world.", With: zbaction.ProcStepArgs{"name": "world"}},
+		},
+	}, nil)
+	resolver.Register("test/legacy", nil)
+
+	return resolver
+}
+
+func TestRenderMarkdown(t *testing.T) {
+	buf := &bytes.Buffer{}
+	assert.NoError(t, procdocs.RenderMarkdown(buf, newTestResolver()))
+
+	assert.Equal(t, "# Procedures\n"+
+		"\n## `test/greet`\n"+
+		"\nGreet someone.\n"+
+		"\n### Arguments\n\n"+
+		"| Name | Type | Required | Default | Description |\n"+
+		"| --- | --- | --- | --- | --- |\n"+
+		"| `name` | string | yes |  | Who to greet. |\n"+
+		"| `style` | string | no | `polite` | One of `polite`, `casual`. |\n"+
+		"\n### Outputs\n\n"+
+		"| Name | Description |\n"+
+		"| --- | --- |\n"+
+		"| `greeting` | The greeting \\| message. |\n"+
+		"\n### Examples\n"+
+		"\nGreet the world.\n"+
+		"\n```json\n{\n  \"uses\": \"test/greet\",\n  \"with\": {\n    \"name\": \"world\"\n  }\n}\n```\n"+
+		"\n## `test/legacy`\n", buf.String())
+}
+
+func TestRenderJSON(t *testing.T) {
+	buf := &bytes.Buffer{}
+	assert.NoError(t, procdocs.RenderJSON(buf, newTestResolver()))
+
+	var procedures []procdocs.Procedure
+	assert.NoError(t, json.Unmarshal(buf.Bytes(), &procedures))
+
+	assert.Len(t, procedures, 2)
+	assert.Equal(t, "test/greet", procedures[0].Name)
+	assert.Equal(t, []procdocs.Argument{
+		{Name: "name", Type: "string", Required: true, Description: "Who to greet."},
+		{Name: "style", Type: "string", Default: "polite", Enum: []string{"polite", "casual"}},
+	}, procedures[0].Arguments)
+	assert.Equal(t, "test/legacy", procedures[1].Name)
+	assert.Empty(t, procedures[1].Arguments)
+}
@@ -3,7 +3,11 @@ package zbaction
 import (
 	"fmt"
 	"log/slog"
+	"sort"
+	"strings"
 	"sync"
+
+	"github.com/Masterminds/semver/v3"
 )
 
 type ProcedureStep interface {
@@ -14,24 +18,81 @@ type ProcedureStepBuilder func(args ProcStepArgs) (ProcedureStep, error)
 
 var resolver = NewProcedureStepResolver()
 
+// ProcedureStepResolver resolves the procedures by name.
+//
+// A procedure can be registered with a semantic version, such as
+// "action/checkout@2.0.0", so several versions can coexist. The versions
+// are picked with a semver constraint in `uses`, such as "action/checkout@v2"
+// or "action/checkout@~2.1". The `uses` without a version resolves to the
+// procedure registered without a version if any, or the latest stable version.
 type ProcedureStepResolver interface {
+	// Register registers a procedure with its builder.
+	// It panics if the procedure has been registered in this resolver,
+	// or the version in the name is not a semantic version.
 	Register(name ProcStepName, builder ProcedureStepBuilder)
+	// RegisterWithSchema registers a procedure like Register.
+	//
+	// If schema is not nil, the arguments are validated against it and
+	// the default values are filled in before calling the builder.
+	RegisterWithSchema(name ProcStepName, schema *ProcedureSchema, builder ProcedureStepBuilder)
+	// Override registers a procedure, replacing the registered one if any.
+	Override(name ProcStepName, builder ProcedureStepBuilder)
+	// OverrideWithSchema overrides a procedure like Override,
+	// with the schema used like RegisterWithSchema.
+	OverrideWithSchema(name ProcStepName, schema *ProcedureSchema, builder ProcedureStepBuilder)
+	// Unregister removes a procedure from this resolver.
+	//
+	// For a resolver with a parent, the procedure in the parent
+	// is hidden as well, until it is registered again.
+	Unregister(name ProcStepName)
 	Resolve(uses ProcStepName, with ProcStepArgs) (ProcedureStep, error)
+	// List lists the names of the registered procedures in order.
+	List() []ProcStepName
+	// Describe gets the schema of a registered procedure.
+	//
+	// ok is false if the procedure is not registered. The schema is nil
+	// if the procedure is registered without a schema.
+	Describe(name ProcStepName) (schema *ProcedureSchema, ok bool)
+}
+
+type registeredProcedure struct {
+	schema  *ProcedureSchema
+	builder ProcedureStepBuilder
 }
 
 type procedureStepResolver struct {
-	registry map[ProcStepName]ProcedureStepBuilder
+	registry map[ProcStepName]registeredProcedure
 	mutex    sync.RWMutex
+
+	// parent is the resolver to fall back to. It can be nil.
+	parent ProcedureStepResolver
+	// hidden is the procedures in parent which are unregistered in this resolver.
+	hidden map[ProcStepName]struct{}
 }
 
 func NewProcedureStepResolver() ProcedureStepResolver {
+	return NewProcedureStepResolverWithParent(nil)
+}
+
+// NewProcedureStepResolverWithParent creates a resolver layered on the parent.
+//
+// The procedures registered in this resolver take precedence, and the others
+// are resolved from the parent. It is useful to swap some procedures of the
+// global registry (see GlobalProcedureResolver) without affecting other actions.
+func NewProcedureStepResolverWithParent(parent ProcedureStepResolver) ProcedureStepResolver {
 	return &procedureStepResolver{
-		registry: make(map[ProcStepName]ProcedureStepBuilder),
+		registry: make(map[ProcStepName]registeredProcedure),
 		mutex:    sync.RWMutex{},
+		parent:   parent,
+		hidden:   make(map[ProcStepName]struct{}),
 	}
 }
 
 func (p *procedureStepResolver) Register(name ProcStepName, builder ProcedureStepBuilder) {
+	p.RegisterWithSchema(name, nil, builder)
+}
+
+func (p *procedureStepResolver) RegisterWithSchema(name ProcStepName, schema *ProcedureSchema, builder ProcedureStepBuilder) {
 	slog.Debug("Registering procedure step", slog.String("name", name))
 
 	p.mutex.Lock()
@@ -42,31 +103,229 @@ func (p *procedureStepResolver) Register(name ProcStepName, builder ProcedureSte
 		panic("namespace conflict")
 	}
 
-	p.registry[name] = builder
+	p.register(name, schema, builder)
+}
+
+func mustValidProcedureVersion(name ProcStepName) {
+	_, version := SplitProcedureVersion(name)
+	if version == "" {
+		return
+	}
+
+	if _, err := semver.StrictNewVersion(strings.TrimPrefix(version, "v")); err != nil {
+		slog.Error("Invalid procedure version.", slog.String("name", name), slog.String("error", err.Error()))
+		panic("invalid procedure version")
+	}
+}
+
+func (p *procedureStepResolver) Override(name ProcStepName, builder ProcedureStepBuilder) {
+	p.OverrideWithSchema(name, nil, builder)
+}
+
+func (p *procedureStepResolver) OverrideWithSchema(name ProcStepName, schema *ProcedureSchema, builder ProcedureStepBuilder) {
+	slog.Debug("Overriding procedure step", slog.String("name", name))
+
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	p.register(name, schema, builder)
+}
+
+func (p *procedureStepResolver) register(name ProcStepName, schema *ProcedureSchema, builder ProcedureStepBuilder) {
+	mustValidProcedureVersion(name)
+
+	delete(p.hidden, name)
+	p.registry[name] = registeredProcedure{
+		schema:  schema,
+		builder: builder,
+	}
+}
+
+func (p *procedureStepResolver) Unregister(name ProcStepName) {
+	slog.Debug("Unregistering procedure step", slog.String("name", name))
+
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	delete(p.registry, name)
+	if p.parent != nil {
+		p.hidden[name] = struct{}{}
+	}
 }
 
 func (p *procedureStepResolver) Resolve(uses ProcStepName, with ProcStepArgs) (ProcedureStep, error) {
 	slog.Debug("Resolving procedure step", slog.String("uses", uses), slog.Any("with", with))
 
+	uses, err := p.match(uses)
+	if err != nil {
+		return nil, err
+	}
+
+	p.mutex.RLock()
+	procedure, ok := p.registry[uses]
+	_, hidden := p.hidden[uses]
+	p.mutex.RUnlock()
+
+	if !ok {
+		if p.parent != nil && !hidden {
+			return p.parent.Resolve(uses, with)
+		}
+
+		return nil, fmt.Errorf("no procedure step builder found for %s", uses)
+	}
+
+	if procedure.schema != nil {
+		if procedure.schema.Deprecated != "" {
+			slog.Warn("Procedure is deprecated.",
+				slog.String("name", uses),
+				slog.String("message", procedure.schema.Deprecated))
+		}
+
+		with, err = procedure.schema.Apply(with)
+		if err != nil {
+			return nil, fmt.Errorf("validate arguments of %s: %w", uses, err)
+		}
+	}
+
+	step, err := procedure.builder(with)
+	if err != nil {
+		return nil, fmt.Errorf("build step %s: %w", uses, err)
+	}
+
+	return step, nil
+}
+
+func (p *procedureStepResolver) List() []ProcStepName {
 	p.mutex.RLock()
 	defer p.mutex.RUnlock()
 
-	if builder, ok := p.registry[uses]; ok {
-		step, err := builder(with)
+	names := make([]ProcStepName, 0, len(p.registry))
+	for name := range p.registry {
+		names = append(names, name)
+	}
+	if p.parent != nil {
+		for _, name := range p.parent.List() {
+			_, registered := p.registry[name]
+			_, hidden := p.hidden[name]
+			if !registered && !hidden {
+				names = append(names, name)
+			}
+		}
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+func (p *procedureStepResolver) Describe(name ProcStepName) (*ProcedureSchema, bool) {
+	name, err := p.match(name)
+	if err != nil {
+		return nil, false
+	}
+
+	p.mutex.RLock()
+	procedure, ok := p.registry[name]
+	_, hidden := p.hidden[name]
+	p.mutex.RUnlock()
+
+	if !ok {
+		if p.parent != nil && !hidden {
+			return p.parent.Describe(name)
+		}
+
+		return nil, false
+	}
+
+	return procedure.schema, true
+}
+
+// match finds the registered procedure name which `uses` refers to.
+//
+// If no procedure with the same name is registered, it returns `uses` as is.
+func (p *procedureStepResolver) match(uses ProcStepName) (ProcStepName, error) {
+	name, constraintString := SplitProcedureVersion(uses)
+
+	var candidates []*semver.Version
+	candidateNames := make(map[*semver.Version]ProcStepName)
+	unversioned := false
+
+	for _, registered := range p.List() {
+		registeredName, versionString := SplitProcedureVersion(registered)
+		if registeredName != name {
+			continue
+		}
+		if versionString == "" {
+			unversioned = true
+			continue
+		}
+
+		version, err := semver.NewVersion(versionString)
 		if err != nil {
-			return nil, fmt.Errorf("build step %s: %w", uses, err)
+			continue
 		}
+		candidates = append(candidates, version)
+		candidateNames[version] = registered
+	}
+
+	if constraintString == "" {
+		if unversioned || len(candidates) == 0 {
+			return uses, nil
+		}
+		constraintString = "*"
+	}
+	if len(candidates) == 0 {
+		return uses, nil
+	}
+
+	constraint, err := semver.NewConstraint(constraintString)
+	if err != nil {
+		return "", fmt.Errorf("invalid version constraint of %s: %w", uses, err)
+	}
 
-		return step, nil
+	sort.Sort(sort.Reverse(semver.Collection(candidates)))
+	for _, candidate := range candidates {
+		if constraint.Check(candidate) {
+			return candidateNames[candidate], nil
+		}
 	}
 
-	return nil, fmt.Errorf("no procedure step builder found for %s", uses)
+	return "", fmt.Errorf("no version of %s matches %s", name, constraintString)
+}
+
+// SplitProcedureVersion splits "name@version" into the name and the version.
+// The version is empty if `uses` has no version.
+func SplitProcedureVersion(uses ProcStepName) (name ProcStepName, version string) {
+	name, version, _ = strings.Cut(uses, "@")
+	return name, version
 }
 
+// RegisterProcedure registers a procedure to the global registry.
 func RegisterProcedure(name ProcStepName, builder ProcedureStepBuilder) {
 	resolver.Register(name, builder)
 }
 
+// RegisterProcedureWithSchema registers a procedure with its schema to the global registry.
+//
+// See ProcedureStepResolver.RegisterWithSchema for the usage of schema.
+func RegisterProcedureWithSchema(name ProcStepName, schema *ProcedureSchema, builder ProcedureStepBuilder) {
+	resolver.RegisterWithSchema(name, schema, builder)
+}
+
 func ResolveProcedure(uses ProcStepName, with ProcStepArgs) (ProcedureStep, error) {
 	return resolver.Resolve(uses, with)
 }
+
+// ListProcedures lists the names of the procedures in the global registry.
+func ListProcedures() []ProcStepName {
+	return resolver.List()
+}
+
+// DescribeProcedure gets the schema of a procedure in the global registry.
+func DescribeProcedure(name ProcStepName) (*ProcedureSchema, bool) {
+	return resolver.Describe(name)
+}
+
+// GlobalProcedureResolver gets the resolver of the global registry.
+func GlobalProcedureResolver() ProcedureStepResolver {
+	return resolver
+}
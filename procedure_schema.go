@@ -0,0 +1,131 @@
+package zbaction
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ArgumentType is the type of the value of a procedure argument.
+type ArgumentType string
+
+const (
+	ArgumentTypeString ArgumentType = "string"
+	ArgumentTypeBool   ArgumentType = "bool"
+	ArgumentTypeInt    ArgumentType = "int"
+)
+
+// ProcedureSchema declares the arguments a procedure accepts.
+type ProcedureSchema struct {
+	// Description is the human-readable description of the procedure.
+	Description string
+	// Arguments are the arguments the procedure accepts.
+	Arguments []ArgumentSchema
+	// Outputs are the outputs the procedure sets.
+	Outputs []OutputSchema
+	// Examples are the examples of using the procedure.
+	Examples []ProcedureExample
+	// Deprecated is the deprecation message, such as the procedure to migrate to.
+	// Non-empty means the procedure is deprecated, and a warning is logged
+	// when it is resolved.
+	Deprecated string
+}
+
+// ArgumentSchema declares an argument of a procedure.
+type ArgumentSchema struct {
+	Name string
+	// Type is the type of the value. By default, it is ArgumentTypeString.
+	Type ArgumentType
+	// Required indicates whether the argument must be specified and not empty.
+	Required bool
+	// Default is the value used when the argument is not specified.
+	// It is ignored if Required is true.
+	Default string
+	// Enum is the allowed values of the argument. Empty means any value.
+	Enum []string
+	// Description is the human-readable description of the argument.
+	Description string
+}
+
+// OutputSchema declares an output of a procedure.
+type OutputSchema struct {
+	Name string
+	// Description is the human-readable description of the output.
+	Description string
+}
+
+// ProcedureExample is an example of using a procedure.
+type ProcedureExample struct {
+	// Description is what the example does.
+	Description string
+	// With is the arguments of the example.
+	With ProcStepArgs
+}
+
+// Apply validates the arguments against the schema, and returns
+// a copy of the arguments with the default values filled in.
+//
+// The values containing variables (`$`) are only checked after they are
+// expanded in the procedure, so their types and enums are not validated here.
+func (s ProcedureSchema) Apply(args ProcStepArgs) (ProcStepArgs, error) {
+	applied := make(ProcStepArgs, len(s.Arguments))
+
+	unknownKeys := make([]string, 0)
+	for key := range args {
+		if !slices.ContainsFunc(s.Arguments, func(a ArgumentSchema) bool { return a.Name == key }) {
+			unknownKeys = append(unknownKeys, key)
+		}
+	}
+	if len(unknownKeys) > 0 {
+		sort.Strings(unknownKeys)
+		return nil, NewErrUnknownArgument(unknownKeys[0])
+	}
+
+	for _, argument := range s.Arguments {
+		value, ok := args[argument.Name]
+
+		if argument.Required && value == "" {
+			return nil, NewErrRequiredArgument(argument.Name)
+		}
+		if !ok {
+			if argument.Default == "" {
+				continue
+			}
+			value = argument.Default
+		}
+
+		if err := argument.validate(value); err != nil {
+			return nil, err
+		}
+
+		applied[argument.Name] = value
+	}
+
+	return applied, nil
+}
+
+func (a ArgumentSchema) validate(value string) error {
+	if strings.ContainsRune(value, '$') {
+		return nil
+	}
+
+	if len(a.Enum) > 0 && !slices.Contains(a.Enum, value) {
+		return NewErrInvalidArgument(a.Name, fmt.Sprintf("must be one of %s", strings.Join(a.Enum, ", ")))
+	}
+
+	switch a.Type {
+	case ArgumentTypeBool:
+		if _, ok := parseBool(value); !ok {
+			return NewErrInvalidArgument(a.Name, "must be a boolean")
+		}
+	case ArgumentTypeInt:
+		if _, err := strconv.Atoi(value); err != nil {
+			return NewErrInvalidArgument(a.Name, "must be an integer")
+		}
+	case ArgumentTypeString, "":
+	}
+
+	return nil
+}
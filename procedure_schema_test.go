@@ -0,0 +1,74 @@
+package zbaction_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	zbaction "github.com/zeabur/action"
+)
+
+var testProcedureSchema = zbaction.ProcedureSchema{
+	Arguments: []zbaction.ArgumentSchema{
+		{Name: "url", Required: true},
+		{Name: "branch", Default: "main"},
+		{Name: "depth", Type: zbaction.ArgumentTypeInt, Default: "1"},
+		{Name: "push", Type: zbaction.ArgumentTypeBool},
+		{Name: "mode", Enum: []string{"fast", "slow"}},
+	},
+}
+
+func TestProcedureSchema_Apply(t *testing.T) {
+	args, err := testProcedureSchema.Apply(zbaction.ProcStepArgs{
+		"url":  "https://github.com/zeabur/action",
+		"push": "true",
+	})
+
+	assert.NoError(t, err)
+	assert.Equal(t, zbaction.ProcStepArgs{
+		"url":    "https://github.com/zeabur/action",
+		"branch": "main",
+		"depth":  "1",
+		"push":   "true",
+	}, args)
+}
+
+func TestProcedureSchema_Apply_Variables(t *testing.T) {
+	_, err := testProcedureSchema.Apply(zbaction.ProcStepArgs{
+		"url":   "${repository}",
+		"depth": "${depth}",
+		"mode":  "${mode}",
+	})
+
+	assert.NoError(t, err)
+}
+
+func TestProcedureSchema_Apply_Invalid(t *testing.T) {
+	_, err := testProcedureSchema.Apply(zbaction.ProcStepArgs{
+		"branch": "main",
+	})
+	assert.ErrorIs(t, err, zbaction.NewErrRequiredArgument("url"))
+
+	_, err = testProcedureSchema.Apply(zbaction.ProcStepArgs{
+		"url":    "https://github.com/zeabur/action",
+		"brnach": "main",
+	})
+	assert.ErrorIs(t, err, zbaction.NewErrUnknownArgument("brnach"))
+
+	_, err = testProcedureSchema.Apply(zbaction.ProcStepArgs{
+		"url":   "https://github.com/zeabur/action",
+		"depth": "full",
+	})
+	assert.ErrorAs(t, err, &zbaction.ErrInvalidArgument{})
+
+	_, err = testProcedureSchema.Apply(zbaction.ProcStepArgs{
+		"url":  "https://github.com/zeabur/action",
+		"push": "yes",
+	})
+	assert.ErrorAs(t, err, &zbaction.ErrInvalidArgument{})
+
+	_, err = testProcedureSchema.Apply(zbaction.ProcStepArgs{
+		"url":  "https://github.com/zeabur/action",
+		"mode": "medium",
+	})
+	assert.ErrorAs(t, err, &zbaction.ErrInvalidArgument{})
+}
@@ -0,0 +1,180 @@
+package zbaction_test
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	zbaction "github.com/zeabur/action"
+)
+
+type fakeStep struct {
+	output string
+}
+
+func (s fakeStep) Run(_ context.Context, sc *zbaction.StepContext) (zbaction.CleanupFn, error) {
+	sc.SetThisOutput("result", s.output)
+	return nil, nil
+}
+
+func fakeBuilder(output string) zbaction.ProcedureStepBuilder {
+	return func(args zbaction.ProcStepArgs) (zbaction.ProcedureStep, error) {
+		return fakeStep{output: output}, nil
+	}
+}
+
+func TestProcedureStepResolver_Layered(t *testing.T) {
+	parent := zbaction.NewProcedureStepResolver()
+	parent.Register("test/a", fakeBuilder("parent-a"))
+	parent.Register("test/b", fakeBuilder("parent-b"))
+	parent.Register("test/c", fakeBuilder("parent-c"))
+
+	overlay := zbaction.NewProcedureStepResolverWithParent(parent)
+	overlay.Register("test/a", fakeBuilder("overlay-a"))
+	overlay.Unregister("test/b")
+	overlay.Register("test/d", fakeBuilder("overlay-d"))
+
+	assert.Equal(t, []zbaction.ProcStepName{"test/a", "test/c", "test/d"}, overlay.List())
+
+	step, err := overlay.Resolve("test/a", nil)
+	assert.NoError(t, err)
+	assert.Equal(t, fakeStep{output: "overlay-a"}, step)
+
+	step, err = overlay.Resolve("test/c", nil)
+	assert.NoError(t, err)
+	assert.Equal(t, fakeStep{output: "parent-c"}, step)
+
+	_, err = overlay.Resolve("test/b", nil)
+	assert.Error(t, err)
+	_, ok := overlay.Describe("test/b")
+	assert.False(t, ok)
+
+	// the parent is not affected.
+	step, err = parent.Resolve("test/b", nil)
+	assert.NoError(t, err)
+	assert.Equal(t, fakeStep{output: "parent-b"}, step)
+}
+
+func TestProcedureStepResolver_Override(t *testing.T) {
+	r := zbaction.NewProcedureStepResolver()
+	r.Register("test/a", fakeBuilder("a"))
+
+	assert.Panics(t, func() {
+		r.Register("test/a", fakeBuilder("b"))
+	})
+
+	r.Override("test/a", fakeBuilder("b"))
+	step, err := r.Resolve("test/a", nil)
+	assert.NoError(t, err)
+	assert.Equal(t, fakeStep{output: "b"}, step)
+
+	r.OverrideWithSchema("test/a", &zbaction.ProcedureSchema{Description: "c"}, fakeBuilder("c"))
+	step, err = r.Resolve("test/a", nil)
+	assert.NoError(t, err)
+	assert.Equal(t, fakeStep{output: "c"}, step)
+	schema, _ := r.Describe("test/a")
+	assert.Equal(t, "c", schema.Description)
+
+	r.Unregister("test/a")
+	assert.Empty(t, r.List())
+}
+
+func TestWithProcedureResolver(t *testing.T) {
+	r := zbaction.NewProcedureStepResolverWithParent(zbaction.GlobalProcedureResolver())
+	r.Register("test/fake", fakeBuilder("fake"))
+
+	stdout := &bytes.Buffer{}
+
+	err := zbaction.RunAction(context.Background(), zbaction.Action{
+		Jobs: []zbaction.Job{
+			{
+				Steps: []zbaction.Step{
+					{
+						ID: "fake",
+						RunnableStep: zbaction.ProcStep{
+							Uses: "test/fake",
+						},
+					},
+					{
+						RunnableStep: zbaction.CommandStep{
+							Command: []string{"echo", "${out.fake.result}"},
+						},
+					},
+				},
+			},
+		},
+	}, zbaction.WithProcedureResolver(r), zbaction.WithCustomStdout(stdout))
+
+	assert.NoError(t, err)
+	assert.Equal(t, "fake\n", stdout.String())
+
+	err = zbaction.RunAction(context.Background(), zbaction.Action{
+		Jobs: []zbaction.Job{
+			{
+				Steps: []zbaction.Step{
+					{
+						RunnableStep: zbaction.ProcStep{
+							Uses: "test/fake",
+						},
+					},
+				},
+			},
+		},
+	})
+	assert.Error(t, err, "the global registry should not have the fake procedure")
+}
+
+func TestProcedureStepResolver_Versions(t *testing.T) {
+	r := zbaction.NewProcedureStepResolver()
+	r.Register("test/a@1.0.0", fakeBuilder("1.0.0"))
+	r.Register("test/a@1.2.0", fakeBuilder("1.2.0"))
+	r.Register("test/a@2.0.0", fakeBuilder("2.0.0"))
+	r.Register("test/a@3.0.0-beta.1", fakeBuilder("3.0.0-beta.1"))
+
+	testcases := []struct {
+		uses     zbaction.ProcStepName
+		expected string
+	}{
+		{"test/a", "2.0.0"},
+		{"test/a@v1", "1.2.0"},
+		{"test/a@1.0.0", "1.0.0"},
+		{"test/a@~1.0", "1.0.0"},
+		{"test/a@>=2.0.0-0", "3.0.0-beta.1"},
+	}
+
+	for _, tc := range testcases {
+		t.Run(tc.uses, func(t *testing.T) {
+			step, err := r.Resolve(tc.uses, nil)
+			assert.NoError(t, err)
+			assert.Equal(t, fakeStep{output: tc.expected}, step)
+		})
+	}
+
+	_, err := r.Resolve("test/a@v4", nil)
+	assert.Error(t, err)
+
+	assert.Panics(t, func() {
+		r.Register("test/a@latest", fakeBuilder("latest"))
+	})
+}
+
+func TestProcedureStepResolver_VersionsWithUnversioned(t *testing.T) {
+	parent := zbaction.NewProcedureStepResolver()
+	parent.Register("test/a", fakeBuilder("legacy"))
+
+	r := zbaction.NewProcedureStepResolverWithParent(parent)
+	r.RegisterWithSchema("test/a@2.0.0", &zbaction.ProcedureSchema{Deprecated: "use test/b"}, fakeBuilder("2.0.0"))
+
+	step, err := r.Resolve("test/a", nil)
+	assert.NoError(t, err)
+	assert.Equal(t, fakeStep{output: "legacy"}, step)
+
+	step, err = r.Resolve("test/a@v2", nil)
+	assert.NoError(t, err)
+	assert.Equal(t, fakeStep{output: "2.0.0"}, step)
+
+	schema, ok := r.Describe("test/a@v2")
+	assert.True(t, ok)
+	assert.Equal(t, "use test/b", schema.Deprecated)
+}
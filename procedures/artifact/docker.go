@@ -26,44 +26,52 @@ import (
 )
 
 func init() {
-	zbaction.RegisterProcedure("action/artifact/docker", func(args zbaction.ProcStepArgs) (zbaction.ProcedureStep, error) {
+	zbaction.RegisterProcedureWithSchema("action/artifact/docker", &zbaction.ProcedureSchema{
+		Description: "Build a Docker image with BuildKit.",
+		Arguments: []zbaction.ArgumentSchema{
+			{Name: "tag", Description: "The tag of the image. By default, a random tag is generated."},
+			{Name: "context", Default: ".", Description: "The directory to run the build in. A relative path is relative to the job root."},
+			{Name: "dockerfile", Default: defaultDockerfile, Description: "The content of the Dockerfile."},
+			{Name: "cache", Type: zbaction.ArgumentTypeBool, Default: "true", Description: "Whether to use cache when building the image."},
+			{Name: "push", Type: zbaction.ArgumentTypeBool, Default: "false", Description: "Whether to push the built image to the registry."},
+		},
+		Outputs: []zbaction.OutputSchema{
+			{Name: "tag", Description: "The tag of the built image."},
+			{Name: "context", Description: "The directory the build ran in."},
+			{Name: "dockerfile", Description: "The path of the Dockerfile."},
+			{Name: "artifact", Description: "The path of the image tarball. It is empty if the image is pushed."},
+		},
+		Examples: []zbaction.ProcedureExample{
+			{
+				Description: "Build the job root and push the image.",
+				With: zbaction.ProcStepArgs{
+					"context":    "${context.root}",
+					"dockerfile": "FROM node:20\nCOPY . .\nRUN npm ci",
+					"tag":        "registry.example.com/app:latest",
+					"push":       "true",
+				},
+			},
+		},
+	}, func(args zbaction.ProcStepArgs) (zbaction.ProcedureStep, error) {
 		tag, ok := args["tag"]
 		if !ok {
 			key := fakelish.GenerateFakeWord(12, 36)
 			tag = "zeabur/built-resource-" + key + ":latest"
 		}
 
-		contextInput, ok := args["context"]
-		if !ok {
-			return nil, zbaction.NewErrRequiredArgument("context")
-		}
-
-		dockerfileInput, ok := args["dockerfile"]
-		if !ok {
-			dockerfileInput = `FROM docker.io/library/alpine:latest
-COPY . .`
-		}
-
-		cache, ok := args["cache"]
-		if !ok {
-			cache = "true"
-		}
-
-		push, ok := args["push"]
-		if !ok {
-			push = "false"
-		}
-
 		return &DockerArtifactAction{
 			Tag:        zbaction.NewArgumentStr(tag),
-			Context:    zbaction.NewArgumentStr(contextInput),
-			Dockerfile: zbaction.NewArgumentStr(dockerfileInput),
-			Cache:      zbaction.NewArgumentBool(cache),
-			Push:       zbaction.NewArgumentBool(push),
+			Context:    zbaction.NewArgumentStr(args["context"]),
+			Dockerfile: zbaction.NewArgumentStr(args["dockerfile"]),
+			Cache:      zbaction.NewArgumentBool(args["cache"]),
+			Push:       zbaction.NewArgumentBool(args["push"]),
 		}, nil
 	})
 }
 
+const defaultDockerfile = `FROM docker.io/library/alpine:latest
+COPY . .`
+
 type DockerArtifactAction struct {
 	// Tag is the tag of this artifact.
 	Tag zbaction.Argument[string]
@@ -81,6 +89,13 @@ type DockerArtifactAction struct {
 
 func (d DockerArtifactAction) Run(ctx context.Context, sc *zbaction.StepContext) (zbaction.CleanupFn, error) {
 	contextDirectory := d.Context.Value(sc.ExpandString)
+	if !filepath.IsAbs(contextDirectory) {
+		resolved, err := zbaction.ResolvePath(sc.Root(), contextDirectory)
+		if err != nil {
+			return nil, err
+		}
+		contextDirectory = resolved
+	}
 	tag := d.Tag.Value(sc.ExpandString)
 	dockerFileContent := d.Dockerfile.Value(sc.ExpandString)
 	cache := d.Cache.Value(sc.ExpandString)
@@ -0,0 +1,228 @@
+package procedures
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	zbaction "github.com/zeabur/action"
+)
+
+func init() {
+	zbaction.RegisterProcedureWithSchema("action/changed-paths", &zbaction.ProcedureSchema{
+		Description: "List the files changed between two commits of a checked out repository. " +
+			"Both commits must be in the repository, so check it out with `depth: 0` or enough depth.",
+		Arguments: []zbaction.ArgumentSchema{
+			{Name: "base", Required: true, Description: "The revision to compare from, such as a SHA, `main` or `origin/main`."},
+			{Name: "head", Default: "HEAD", Description: "The revision to compare to."},
+			{Name: "mergeBase", Type: zbaction.ArgumentTypeBool, Default: "false", Description: "Compare from the merge base of `base` and `head`, like `git diff base...head`."},
+			{Name: "path", Description: "The directory of the repository, relative to the job root. By default, it is the job root."},
+			{Name: "filters", Description: "The path filters, one per line, as `<name>: <pattern>, <pattern>`. " +
+				"A pattern matches the files it names, the files in the directories it names, and the globs of `path.Match`."},
+		},
+		Outputs: []zbaction.OutputSchema{
+			{Name: "files", Description: "The changed files, one per line. A renamed file is listed with both names."},
+			{Name: "count", Description: "The number of the changed files."},
+			{Name: "changed", Description: "`true` if any file is changed, otherwise `false`."},
+			{Name: "changed.<name>", Description: "`true` if any file matching the filter `<name>` is changed, otherwise `false`."},
+		},
+		Examples: []zbaction.ProcedureExample{
+			{
+				Description: "Check which services of a monorepo are changed in a pull request. " +
+					"The result of the API service is `${out.<step_id>.changed.api}`.",
+				With: zbaction.ProcStepArgs{
+					"base":      "${BASE_SHA}",
+					"mergeBase": "true",
+					"filters":   "api: services/api, libs\nweb: services/web, libs",
+				},
+			},
+		},
+	}, func(args zbaction.ProcStepArgs) (zbaction.ProcedureStep, error) {
+		if filters := args["filters"]; !strings.Contains(filters, "$") {
+			if _, err := parsePathFilters(filters); err != nil {
+				return nil, err
+			}
+		}
+
+		return &ChangedPathsAction{
+			Base:      zbaction.NewArgumentStr(args["base"]),
+			Head:      zbaction.NewArgumentStr(args["head"]),
+			MergeBase: zbaction.NewArgumentBool(args["mergeBase"]),
+			Path:      zbaction.NewArgumentStr(args["path"]),
+			Filters:   zbaction.NewArgumentStr(args["filters"]),
+		}, nil
+	})
+}
+
+type ChangedPathsAction struct {
+	Base      zbaction.Argument[string]
+	Head      zbaction.Argument[string]
+	MergeBase zbaction.Argument[bool]
+	Path      zbaction.Argument[string]
+	Filters   zbaction.Argument[string]
+}
+
+func (i *ChangedPathsAction) Run(ctx context.Context, sc *zbaction.StepContext) (zbaction.CleanupFn, error) {
+	filters, err := parsePathFilters(i.Filters.Value(sc.ExpandString))
+	if err != nil {
+		return nil, err
+	}
+
+	repositoryPath, err := zbaction.ResolvePath(sc.Root(), i.Path.Value(sc.ExpandString))
+	if err != nil {
+		return nil, fmt.Errorf("resolve path: %w", err)
+	}
+
+	repository, err := git.PlainOpen(repositoryPath)
+	if err != nil {
+		return nil, fmt.Errorf("open repository: %w", err)
+	}
+
+	base, err := resolveCommit(repository, i.Base.Value(sc.ExpandString))
+	if err != nil {
+		return nil, err
+	}
+	head, err := resolveCommit(repository, i.Head.Value(sc.ExpandString))
+	if err != nil {
+		return nil, err
+	}
+
+	if i.MergeBase.Value(sc.ExpandString) {
+		bases, err := base.MergeBase(head)
+		if err != nil {
+			return nil, fmt.Errorf("find merge base: %w", err)
+		}
+		if len(bases) == 0 {
+			return nil, fmt.Errorf("no merge base of %s and %s", base.Hash, head.Hash)
+		}
+		base = bases[0]
+	}
+
+	files, err := changedFiles(ctx, base, head)
+	if err != nil {
+		return nil, err
+	}
+
+	sc.SetThisOutput("files", strings.Join(files, "\n"))
+	sc.SetThisOutput("count", strconv.Itoa(len(files)))
+	sc.SetThisOutput("changed", strconv.FormatBool(len(files) > 0))
+	for _, filter := range filters {
+		changed := slices.ContainsFunc(files, filter.Match)
+		sc.SetThisOutput("changed."+filter.Name, strconv.FormatBool(changed))
+	}
+
+	return nil, nil
+}
+
+func resolveCommit(repository *git.Repository, revision string) (*object.Commit, error) {
+	hash, err := repository.ResolveRevision(plumbing.Revision(revision))
+	if err != nil {
+		return nil, fmt.Errorf("resolve %s: %w", revision, err)
+	}
+
+	commit, err := repository.CommitObject(*hash)
+	if err != nil {
+		return nil, fmt.Errorf("get commit %s: %w", hash, err)
+	}
+
+	return commit, nil
+}
+
+// changedFiles lists the files changed from base to head, sorted by name.
+func changedFiles(ctx context.Context, base, head *object.Commit) ([]string, error) {
+	baseTree, err := base.Tree()
+	if err != nil {
+		return nil, fmt.Errorf("get tree of %s: %w", base.Hash, err)
+	}
+	headTree, err := head.Tree()
+	if err != nil {
+		return nil, fmt.Errorf("get tree of %s: %w", head.Hash, err)
+	}
+
+	changes, err := object.DiffTreeWithOptions(ctx, baseTree, headTree, object.DefaultDiffTreeOptions)
+	if err != nil {
+		return nil, fmt.Errorf("diff %s and %s: %w", base.Hash, head.Hash, err)
+	}
+
+	files := make([]string, 0, len(changes))
+	for _, change := range changes {
+		for _, name := range []string{change.From.Name, change.To.Name} {
+			if name != "" && !slices.Contains(files, name) {
+				files = append(files, name)
+			}
+		}
+	}
+	slices.Sort(files)
+
+	return files, nil
+}
+
+// PathFilter is a named set of path patterns.
+type PathFilter struct {
+	Name     string
+	Patterns []string
+}
+
+// Match checks if file matches any pattern of the filter.
+//
+// A pattern matches the file itself, or any directory containing it.
+func (f PathFilter) Match(file string) bool {
+	for _, pattern := range f.Patterns {
+		for p := file; p != "." && p != "/"; p = path.Dir(p) {
+			if matched, _ := path.Match(pattern, p); matched {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// parsePathFilters parses the filters in the format of `<name>: <pattern>, <pattern>`, one per line.
+func parsePathFilters(s string) ([]PathFilter, error) {
+	var filters []PathFilter
+
+	for _, line := range strings.Split(s, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+
+		name, patterns, ok := strings.Cut(line, ":")
+		name = strings.TrimSpace(name)
+		if !ok || name == "" {
+			return nil, zbaction.NewErrInvalidArgument("filters", "expected <name>: <patterns>: "+line)
+		}
+		if slices.ContainsFunc(filters, func(f PathFilter) bool { return f.Name == name }) {
+			return nil, zbaction.NewErrInvalidArgument("filters", "duplicate filter: "+name)
+		}
+
+		filter := PathFilter{Name: name}
+		for _, pattern := range strings.Split(patterns, ",") {
+			pattern = path.Clean(strings.Trim(strings.TrimSpace(pattern), "/"))
+			if pattern == "." {
+				continue
+			}
+			if _, err := path.Match(pattern, ""); err != nil {
+				return nil, zbaction.NewErrInvalidArgument("filters", "invalid pattern "+pattern+": "+err.Error())
+			}
+
+			filter.Patterns = append(filter.Patterns, pattern)
+		}
+		if len(filter.Patterns) == 0 {
+			return nil, zbaction.NewErrInvalidArgument("filters", "no patterns in filter: "+name)
+		}
+
+		filters = append(filters, filter)
+	}
+
+	return filters, nil
+}
+
+var _ zbaction.ProcedureStep = (*ChangedPathsAction)(nil)
@@ -0,0 +1,97 @@
+package procedures_test
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	zbaction "github.com/zeabur/action"
+)
+
+func TestChangedPaths(t *testing.T) {
+	repository := newTestRepository(t)
+
+	testcases := []struct {
+		name     string
+		with     zbaction.ProcStepArgs
+		expected string
+	}{
+		{
+			"head",
+			zbaction.ProcStepArgs{"base": repository.Initial.String()},
+			"1|true|false|false|true\npull.txt\n",
+		},
+		{
+			"base and head",
+			zbaction.ProcStepArgs{"base": repository.Initial.String(), "head": "refs/remotes/origin/main"},
+			"2|true|true|false|true\nmain.txt\nservices/api/api.txt\n",
+		},
+		{
+			"branch",
+			zbaction.ProcStepArgs{"base": "refs/remotes/origin/main"},
+			"3|true|true|false|true\nmain.txt\npull.txt\nservices/api/api.txt\n",
+		},
+		{
+			"merge base",
+			zbaction.ProcStepArgs{"base": "refs/remotes/origin/main", "mergeBase": "true"},
+			"1|true|false|false|true\npull.txt\n",
+		},
+		{
+			"unchanged",
+			zbaction.ProcStepArgs{"base": "HEAD"},
+			"0|false|false|false|false\n\n",
+		},
+	}
+
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			tc.with["filters"] = "api: services/api, libs\nweb: services/web/\ntext: *.txt"
+			stdout := &bytes.Buffer{}
+
+			err := zbaction.RunAction(context.Background(), zbaction.Action{
+				Jobs: []zbaction.Job{
+					{
+						Steps: []zbaction.Step{
+							{
+								// check out the pull request with the history of main
+								RunnableStep: zbaction.ProcStep{Uses: "action/checkout", With: zbaction.ProcStepArgs{
+									"url":   repository.URL,
+									"ref":   "main",
+									"sha":   repository.Pull.String(),
+									"depth": "0",
+								}},
+							},
+							{
+								ID:           "changes",
+								RunnableStep: zbaction.ProcStep{Uses: "action/changed-paths", With: tc.with},
+							},
+							{
+								RunnableStep: zbaction.CommandStep{
+									Command: []string{"echo", "${out.changes.count}|${out.changes.changed}|${out.changes.changed.api}|${out.changes.changed.web}|${out.changes.changed.text}\n${out.changes.files}"},
+								},
+							},
+						},
+					},
+				},
+			}, zbaction.WithCustomStdout(stdout))
+
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expected, stdout.String())
+		})
+	}
+}
+
+func TestChangedPaths_InvalidFilters(t *testing.T) {
+	for _, filters := range []string{"services/api", "api: services/api\napi: libs", "api: [", "api: ,"} {
+		_, err := runCheckout(t, zbaction.Step{
+			RunnableStep: zbaction.ProcStep{Uses: "action/changed-paths", With: zbaction.ProcStepArgs{
+				"base":    "HEAD",
+				"filters": filters,
+			}},
+		})
+
+		var invalidArgument zbaction.ErrInvalidArgument
+		assert.ErrorAs(t, err, &invalidArgument, filters)
+	}
+}
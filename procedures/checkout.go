@@ -2,75 +2,589 @@ package procedures
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/config"
 	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/transport"
 	"github.com/go-git/go-git/v5/plumbing/transport/http"
+	gitssh "github.com/go-git/go-git/v5/plumbing/transport/ssh"
 	zbaction "github.com/zeabur/action"
+	"github.com/zeabur/action/procedures/procvariables"
 )
 
 func init() {
-	zbaction.RegisterProcedure("action/checkout", func(args zbaction.ProcStepArgs) (zbaction.ProcedureStep, error) {
-		depth, ok := args["depth"]
-		if !ok {
-			depth = "1"
+	zbaction.RegisterProcedureWithSchema("action/checkout", &zbaction.ProcedureSchema{
+		Description: "Clone a Git repository into the job root. If the runtime variable `" + procvariables.VarCheckoutCacheDirectoryKey + "` is set, the repository is mirrored in the directory and reused across the checkouts with the same credential.",
+		Arguments: []zbaction.ArgumentSchema{
+			{Name: "url", Required: true, Description: "The URL of the repository."},
+			{Name: "branch", Description: "The branch to check out. Ignored if `ref` is specified."},
+			{Name: "ref", Description: "The ref to check out, such as `main`, `v1.0.0` or `refs/pull/123/head`. By default, it is the default branch of the repository."},
+			{Name: "sha", Description: "The commit to check out. If `ref` is also specified, the commit is looked up in the fetched ref first."},
+			{Name: "depth", Type: zbaction.ArgumentTypeInt, Default: "1", Description: "The number of commits to fetch. `0` fetches the full history. The full history is always available with the mirror cache."},
+			{Name: "tags", Type: zbaction.ArgumentTypeBool, Default: "false", Description: "Fetch all the tags, such as for `action/git-version`."},
+			{Name: "submodules", Default: string(SubmoduleModeRecursive), Enum: []string{string(SubmoduleModeNone), string(SubmoduleModeTopLevel), string(SubmoduleModeRecursive)}, Description: "How to check out the submodules."},
+			{Name: "sparse", Description: "The directories to check out, separated by newlines or commas. By default, the whole tree is checked out."},
+			{Name: "path", Description: "The directory to clone into, relative to the job root. By default, it is the job root."},
+			{Name: "authUsername", Description: "The username for HTTP basic authentication."},
+			{Name: "authPassword", Description: "The password for HTTP basic authentication."},
+			{Name: "authToken", Description: "The token for HTTP bearer authentication. It takes precedence over the basic authentication."},
+			{Name: "sshKey", Description: "The PEM-encoded private key for SSH authentication. It takes precedence over the HTTP authentication."},
+			{Name: "sshKeyPassphrase", Description: "The passphrase of `sshKey`."},
+			{Name: "knownHosts", Description: "The known_hosts entries to verify the SSH host key with. By default, `~/.ssh/known_hosts` is used."},
+		},
+		Outputs: []zbaction.OutputSchema{
+			{Name: "path", Description: "The absolute path of the cloned repository."},
+			{Name: "ref", Description: "The full name of the fetched ref, such as `refs/heads/main` for the default branch. Empty if only `sha` is fetched."},
+			{Name: "sha", Description: "The SHA of the checked out commit."},
+			{Name: "shortSha", Description: "The first 7 characters of the SHA."},
+			{Name: "message", Description: "The message of the commit."},
+			{Name: "author", Description: "The author of the commit, as `Name <email>`."},
+			{Name: "timestamp", Description: "The time the commit was authored, in RFC 3339."},
+		},
+		Examples: []zbaction.ProcedureExample{
+			{
+				Description: "Check out the main branch of a public repository.",
+				With: zbaction.ProcStepArgs{
+					"url":    "https://github.com/zeabur/action.git",
+					"branch": "main",
+				},
+			},
+			{
+				Description: "Check out a private repository over SSH into a subdirectory.",
+				With: zbaction.ProcStepArgs{
+					"url":        "git@github.com:zeabur/private.git",
+					"path":       "private",
+					"sshKey":     "${DEPLOY_KEY}",
+					"knownHosts": "github.com ssh-ed25519 AAAAC3NzaC1lZDI1NTE5AAAAIOMqqnkVzrm0SdG6UOoqKLsabgH5C9okWi0dh2l9GKJl",
+				},
+			},
+			{
+				Description: "Check out a part of a monorepo without the submodules.",
+				With: zbaction.ProcStepArgs{
+					"url":        "https://github.com/zeabur/monorepo.git",
+					"sparse":     "services/api,libs",
+					"submodules": "none",
+				},
+			},
+			{
+				Description: "Check out the head of a pull request.",
+				With: zbaction.ProcStepArgs{
+					"url": "https://github.com/zeabur/action.git",
+					"ref": "refs/pull/123/head",
+				},
+			},
+		},
+	}, func(args zbaction.ProcStepArgs) (zbaction.ProcedureStep, error) {
+		// validate the arguments without variables early;
+		// the others are validated after they are expanded.
+		if depth := args["depth"]; !strings.Contains(depth, "$") {
+			if _, err := parseCheckoutDepth(depth); err != nil {
+				return nil, err
+			}
+		}
+		if submodules := args["submodules"]; !strings.Contains(submodules, "$") {
+			if _, err := parseSubmoduleMode(submodules); err != nil {
+				return nil, err
+			}
+		}
+		if sparse := args["sparse"]; !strings.Contains(sparse, "$") {
+			if _, err := parseSparseDirectories(sparse); err != nil {
+				return nil, err
+			}
 		}
 
 		return &CheckoutAction{
-			URL:    zbaction.NewArgumentStr(args["url"]),
-			Branch: zbaction.NewArgumentStr(args["branch"]),
-			Depth: zbaction.NewArgument(depth, func(s string) int {
-				if i, err := strconv.Atoi(s); err == nil {
-					return i
-				}
-				return 1
-			}),
-			AuthUsername: zbaction.NewArgumentStr(args["authUsername"]),
-			AuthPassword: zbaction.NewArgumentStr(args["authPassword"]),
+			URL:              zbaction.NewArgumentStr(args["url"]),
+			Branch:           zbaction.NewArgumentStr(args["branch"]),
+			Ref:              zbaction.NewArgumentStr(args["ref"]),
+			SHA:              zbaction.NewArgumentStr(args["sha"]),
+			Depth:            zbaction.NewArgumentStr(args["depth"]),
+			Tags:             zbaction.NewArgumentBool(args["tags"]),
+			Submodules:       zbaction.NewArgumentStr(args["submodules"]),
+			Sparse:           zbaction.NewArgumentStr(args["sparse"]),
+			Path:             zbaction.NewArgumentStr(args["path"]),
+			AuthUsername:     zbaction.NewArgumentStr(args["authUsername"]),
+			AuthPassword:     zbaction.NewArgumentStr(args["authPassword"]),
+			AuthToken:        zbaction.NewArgumentStr(args["authToken"]),
+			SSHKey:           zbaction.NewArgumentStr(args["sshKey"]),
+			SSHKeyPassphrase: zbaction.NewArgumentStr(args["sshKeyPassphrase"]),
+			KnownHosts:       zbaction.NewArgumentStr(args["knownHosts"]),
 		}, nil
 	})
 }
 
 type CheckoutAction struct {
-	URL          zbaction.Argument[string]
-	Branch       zbaction.Argument[string]
-	Depth        zbaction.Argument[int]
-	AuthUsername zbaction.Argument[string]
-	AuthPassword zbaction.Argument[string]
+	URL              zbaction.Argument[string]
+	Branch           zbaction.Argument[string]
+	Ref              zbaction.Argument[string]
+	SHA              zbaction.Argument[string]
+	Depth            zbaction.Argument[string]
+	Tags             zbaction.Argument[bool]
+	Submodules       zbaction.Argument[string]
+	Sparse           zbaction.Argument[string]
+	Path             zbaction.Argument[string]
+	AuthUsername     zbaction.Argument[string]
+	AuthPassword     zbaction.Argument[string]
+	AuthToken        zbaction.Argument[string]
+	SSHKey           zbaction.Argument[string]
+	SSHKeyPassphrase zbaction.Argument[string]
+	KnownHosts       zbaction.Argument[string]
 }
 
 func (i *CheckoutAction) Run(ctx context.Context, sc *zbaction.StepContext) (zbaction.CleanupFn, error) {
 	url := i.URL.Value(sc.ExpandString)
 	branch := i.Branch.Value(sc.ExpandString)
-	depth := i.Depth.Value(sc.ExpandString)
+	ref := i.Ref.Value(sc.ExpandString)
+	sha := i.SHA.Value(sc.ExpandString)
+
+	depth, err := parseCheckoutDepth(i.Depth.Value(sc.ExpandString))
+	if err != nil {
+		return nil, err
+	}
+	submoduleMode, err := parseSubmoduleMode(i.Submodules.Value(sc.ExpandString))
+	if err != nil {
+		return nil, err
+	}
+	sparseDirectories, err := parseSparseDirectories(i.Sparse.Value(sc.ExpandString))
+	if err != nil {
+		return nil, err
+	}
+
+	if ref == "" && branch != "" {
+		ref = "refs/heads/" + branch
+	}
+
+	path, err := zbaction.ResolvePath(sc.Root(), i.Path.Value(sc.ExpandString))
+	if err != nil {
+		return nil, err
+	}
+
+	auth, err := i.auth(sc, url)
+	if err != nil {
+		return nil, err
+	}
+
+	// with a cache directory, the objects are fetched into the mirror
+	// of the repository, and the workspace uses the objects in it.
+	var mirror *gitMirror
+	if cacheDirectory, ok := sc.VariableContainer().GetVariable(procvariables.VarCheckoutCacheDirectoryKey); ok && cacheDirectory != "" {
+		mirror, err = openGitMirror(cacheDirectory, url, auth)
+		if err != nil {
+			return nil, err
+		}
+		defer mirror.Close()
+	}
+
+	var repository *git.Repository
+	if mirror != nil {
+		repository, err = mirror.InitWorkspace(path)
+	} else {
+		repository, err = git.PlainInit(path, false)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("init repository: %w", err)
+	}
+
+	remote, err := repository.CreateRemote(&config.RemoteConfig{
+		Name: git.DefaultRemoteName,
+		URLs: []string{url},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("create remote: %w", err)
+	}
+
+	fetch := func(refSpec config.RefSpec, depth int) error {
+		if mirror != nil {
+			return mirror.FetchInto(ctx, repository, refSpec, auth, sc.Stderr())
+		}
+
+		err := remote.FetchContext(ctx, &git.FetchOptions{
+			RefSpecs: []config.RefSpec{refSpec},
+			Depth:    depth,
+			Auth:     auth,
+			Progress: sc.Stderr(),
+		})
+		if err != nil && !errors.Is(err, git.NoErrAlreadyUpToDate) {
+			return fmt.Errorf("fetch %s: %w", refSpec, err)
+		}
+		return nil
+	}
+
+	// fetch the ref unless only an exact SHA is specified,
+	// which can be fetched directly.
+	var fetchedRef plumbing.ReferenceName
+	if ref != "" || !isExactSHA(sha) {
+		fetchedRef, err = resolveRemoteRef(ctx, remote, ref, auth)
+		if err != nil {
+			return nil, err
+		}
+
+		if err := fetch(config.RefSpec("+"+fetchedRef.String()+":"+localRefName(fetchedRef).String()), depth); err != nil {
+			return nil, err
+		}
+	}
+
+	if i.Tags.Value(sc.ExpandString) {
+		if err := fetch(config.RefSpec("+refs/tags/*:refs/tags/*"), depth); err != nil {
+			return nil, err
+		}
+	}
+
+	var revision plumbing.Revision
+	switch {
+	case sha != "":
+		revision = plumbing.Revision(sha)
+
+		if _, err := repository.ResolveRevision(revision); err != nil && isExactSHA(sha) {
+			err := fetch(config.RefSpec(sha+":"+localRefName(plumbing.ReferenceName(sha)).String()), depth)
+			if errors.Is(err, git.ErrExactSHA1NotSupported) {
+				// look for the commit in the full history of the branches instead
+				err = fetch(config.RefSpec("+refs/heads/*:refs/remotes/"+git.DefaultRemoteName+"/*"), 0)
+			}
+			if err != nil {
+				return nil, err
+			}
+		}
+	default:
+		revision = plumbing.Revision(localRefName(fetchedRef))
+	}
+
+	hash, err := repository.ResolveRevision(revision)
+	if err != nil {
+		return nil, fmt.Errorf("resolve %s: %w", revision, err)
+	}
+
+	worktree, err := repository.Worktree()
+	if err != nil {
+		return nil, fmt.Errorf("get worktree: %w", err)
+	}
+
+	err = worktree.Checkout(&git.CheckoutOptions{
+		Hash:                      *hash,
+		Force:                     true,
+		SparseCheckoutDirectories: sparseDirectories,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("checkout %s: %w", hash, err)
+	}
+	if len(sparseDirectories) > 0 {
+		if err := removeOutsideSparse(path, "", sparseDirectories); err != nil {
+			return nil, fmt.Errorf("remove files outside sparse directories: %w", err)
+		}
+	}
+
+	if submoduleMode != SubmoduleModeNone {
+		recursion := git.DefaultSubmoduleRecursionDepth
+		if submoduleMode == SubmoduleModeTopLevel {
+			recursion = git.NoRecurseSubmodules
+		}
+
+		submodules, err := worktree.Submodules()
+		if err != nil {
+			return nil, fmt.Errorf("list submodules: %w", err)
+		}
+		err = submodules.UpdateContext(ctx, &git.SubmoduleUpdateOptions{
+			Init:              true,
+			RecurseSubmodules: recursion,
+			Auth:              auth,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("update submodules: %w", err)
+		}
+	}
+
+	commit, err := repository.CommitObject(*hash)
+	if err != nil {
+		return nil, fmt.Errorf("get commit %s: %w", hash, err)
+	}
+
+	sc.SetThisOutput("path", path)
+	sc.SetThisOutput("ref", fetchedRef.String())
+	sc.SetThisOutput("sha", commit.Hash.String())
+	sc.SetThisOutput("shortSha", commit.Hash.String()[:7])
+	sc.SetThisOutput("message", commit.Message)
+	sc.SetThisOutput("author", commit.Author.String())
+	sc.SetThisOutput("timestamp", commit.Author.When.Format(time.RFC3339))
+
+	return nil, nil
+}
+
+// auth gets the authentication method of the repository.
+func (i *CheckoutAction) auth(sc *zbaction.StepContext, url string) (transport.AuthMethod, error) {
 	authUsername := i.AuthUsername.Value(sc.ExpandString)
 	authPassword := i.AuthPassword.Value(sc.ExpandString)
+	authToken := i.AuthToken.Value(sc.ExpandString)
+	sshKey := i.SSHKey.Value(sc.ExpandString)
+
+	switch {
+	case sshKey != "":
+		user := "git"
+		if endpoint, err := transport.NewEndpoint(url); err == nil && endpoint.User != "" {
+			user = endpoint.User
+		}
+
+		publicKeys, err := gitssh.NewPublicKeys(user, []byte(sshKey), i.SSHKeyPassphrase.Value(sc.ExpandString))
+		if err != nil {
+			return nil, fmt.Errorf("parse ssh key: %w", err)
+		}
+
+		if err := setKnownHosts(publicKeys, i.KnownHosts.Value(sc.ExpandString)); err != nil {
+			return nil, fmt.Errorf("load known hosts: %w", err)
+		}
 
-	var auth *http.BasicAuth
-	if authUsername != "" && authPassword != "" {
-		auth = &http.BasicAuth{
+		return publicKeys, nil
+	case authToken != "":
+		return &http.TokenAuth{Token: authToken}, nil
+	case authUsername != "" && authPassword != "":
+		return &http.BasicAuth{
 			Username: authUsername,
 			Password: authPassword,
+		}, nil
+	default:
+		return nil, nil
+	}
+}
+
+// setKnownHosts verifies the host key with the known_hosts entries.
+// If knownHosts is empty, the default known_hosts files are used.
+func setKnownHosts(publicKeys *gitssh.PublicKeys, knownHosts string) error {
+	if knownHosts == "" {
+		callback, err := gitssh.NewKnownHostsCallback()
+		if err != nil {
+			return err
 		}
+
+		publicKeys.HostKeyCallback = callback
+		return nil
 	}
 
-	_, err := git.PlainCloneContext(
-		ctx,
-		sc.Root(),
-		false,
-		&git.CloneOptions{
-			URL:               url,
-			Progress:          sc.Stderr(),
-			Depth:             depth,
-			ReferenceName:     plumbing.ReferenceName("refs/heads/" + branch),
-			SingleBranch:      true,
-			RecurseSubmodules: git.DefaultSubmoduleRecursionDepth,
-			Auth:              auth,
-		},
-	)
+	file, err := os.CreateTemp("", "zbaction-known-hosts-*")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = os.Remove(file.Name())
+	}()
+
+	_, err = file.WriteString(knownHosts + "\n")
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+
+	// the entries are read when the callback is created,
+	// so the file can be removed afterward.
+	callback, err := gitssh.NewKnownHostsCallback(file.Name())
+	if err != nil {
+		return err
+	}
+
+	publicKeys.HostKeyCallback = callback
+	return nil
+}
+
+// SubmoduleMode is how action/checkout checks out the submodules.
+type SubmoduleMode string
+
+const (
+	// SubmoduleModeNone does not check out the submodules.
+	SubmoduleModeNone SubmoduleMode = "none"
+	// SubmoduleModeTopLevel checks out the submodules of the repository,
+	// but not the nested submodules.
+	SubmoduleModeTopLevel SubmoduleMode = "top-level"
+	// SubmoduleModeRecursive checks out the submodules recursively.
+	SubmoduleModeRecursive SubmoduleMode = "recursive"
+)
+
+func parseCheckoutDepth(s string) (int, error) {
+	depth, err := strconv.Atoi(s)
+	if err != nil {
+		return 0, zbaction.NewErrInvalidArgument("depth", "not an integer: "+s)
+	}
+	if depth < 0 {
+		return 0, zbaction.NewErrInvalidArgument("depth", "must not be negative")
+	}
+
+	return depth, nil
+}
+
+func parseSubmoduleMode(s string) (SubmoduleMode, error) {
+	switch mode := SubmoduleMode(s); mode {
+	case SubmoduleModeNone, SubmoduleModeTopLevel, SubmoduleModeRecursive:
+		return mode, nil
+	default:
+		return "", zbaction.NewErrInvalidArgument("submodules", "unknown mode: "+s)
+	}
+}
+
+// parseSparseDirectories parses the directories separated by newlines or commas.
+// The directories must be relative and inside the repository.
+func parseSparseDirectories(s string) ([]string, error) {
+	fields := strings.FieldsFunc(s, func(r rune) bool {
+		return r == '\n' || r == ','
+	})
+
+	directories := make([]string, 0, len(fields))
+	for _, field := range fields {
+		directory := strings.TrimSpace(field)
+		if directory == "" {
+			continue
+		}
+
+		cleaned := path.Clean(strings.Trim(directory, "/"))
+		if path.IsAbs(directory) || cleaned == "." || cleaned == ".." || strings.HasPrefix(cleaned, "../") {
+			return nil, zbaction.NewErrInvalidArgument("sparse", "not a directory in the repository: "+directory)
+		}
+
+		directories = append(directories, cleaned)
+	}
+
+	if len(directories) == 0 {
+		return nil, nil
+	}
+
+	return directories, nil
+}
+
+// removeOutsideSparse removes the files in dir which are outside the sparse directories.
+//
+// go-git marks these files as skip-worktree in the index,
+// but still writes them to the worktree.
+func removeOutsideSparse(root string, dir string, directories []string) error {
+	entries, err := os.ReadDir(filepath.Join(root, dir))
+	if err != nil {
+		return err
+	}
+
+	for _, entry := range entries {
+		if dir == "" && entry.Name() == git.GitDirName {
+			continue
+		}
+
+		name := path.Join(dir, entry.Name())
+
+		inside, ancestor := false, false
+		for _, directory := range directories {
+			inside = inside || name == directory || strings.HasPrefix(name, directory+"/")
+			ancestor = ancestor || strings.HasPrefix(directory, name+"/")
+		}
+
+		switch {
+		case inside:
+			continue
+		case ancestor && entry.IsDir():
+			if err := removeOutsideSparse(root, name, directories); err != nil {
+				return err
+			}
+		default:
+			if err := os.RemoveAll(filepath.Join(root, name)); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// resolveRemoteRef finds the full name of ref in the remote.
+//
+// A short name is looked up in the branches, and then the tags.
+// An empty ref refers to the default branch of the remote.
+func resolveRemoteRef(ctx context.Context, remote *git.Remote, ref string, auth transport.AuthMethod) (plumbing.ReferenceName, error) {
+	refs, err := remote.ListContext(ctx, &git.ListOptions{Auth: auth})
+	if err != nil {
+		return "", fmt.Errorf("list remote refs: %w", err)
+	}
+
+	if ref == "" {
+		return remoteDefaultBranch(refs), nil
+	}
+
+	candidates := []plumbing.ReferenceName{plumbing.ReferenceName(ref)}
+	if !strings.HasPrefix(ref, "refs/") {
+		candidates = []plumbing.ReferenceName{
+			plumbing.NewBranchReferenceName(ref),
+			plumbing.NewTagReferenceName(ref),
+		}
+	}
+
+	for _, candidate := range candidates {
+		for _, r := range refs {
+			if r.Name() == candidate {
+				return candidate, nil
+			}
+		}
+	}
+
+	return "", fmt.Errorf("ref %s not found in the remote", ref)
+}
+
+// remoteDefaultBranch finds the branch the HEAD of the remote refers to.
+//
+// If the remote does not advertise the symbolic HEAD, it is the first branch
+// pointing to the same commit as HEAD, like what `git clone` guesses.
+// It is HEAD itself if HEAD is detached from any branch.
+func remoteDefaultBranch(refs []*plumbing.Reference) plumbing.ReferenceName {
+	var head *plumbing.Reference
+	for _, r := range refs {
+		if r.Name() == plumbing.HEAD {
+			head = r
+			break
+		}
+	}
+	if head == nil {
+		return plumbing.HEAD
+	}
+	if head.Type() == plumbing.SymbolicReference {
+		return head.Target()
+	}
+
+	var branches []plumbing.ReferenceName
+	for _, r := range refs {
+		if r.Name().IsBranch() && r.Hash() == head.Hash() {
+			branches = append(branches, r.Name())
+		}
+	}
+	if len(branches) == 0 {
+		return plumbing.HEAD
+	}
+	slices.Sort(branches)
+
+	return branches[0]
+}
+
+// localRefName gets the local name of a fetched remote ref.
+func localRefName(ref plumbing.ReferenceName) plumbing.ReferenceName {
+	switch {
+	case ref.IsBranch():
+		return plumbing.NewRemoteReferenceName(git.DefaultRemoteName, ref.Short())
+	case ref.IsTag():
+		return ref
+	case ref == plumbing.HEAD:
+		return plumbing.NewRemoteHEADReferenceName(git.DefaultRemoteName)
+	case strings.HasPrefix(ref.String(), "refs/"):
+		return ref
+	default:
+		// a commit SHA
+		return plumbing.ReferenceName("refs/zbaction/" + ref.String())
+	}
+}
 
-	return nil, err
+// isExactSHA checks whether s is a full SHA-1 hash.
+func isExactSHA(s string) bool {
+	return len(s) == 40 && strings.Trim(strings.ToLower(s), "0123456789abcdef") == ""
 }
 
 var _ zbaction.ProcedureStep = (*CheckoutAction)(nil)
@@ -0,0 +1,196 @@
+package procedures
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/go-git/go-billy/v5/osfs"
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/config"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/cache"
+	"github.com/go-git/go-git/v5/plumbing/transport"
+	"github.com/go-git/go-git/v5/plumbing/transport/http"
+	gitssh "github.com/go-git/go-git/v5/plumbing/transport/ssh"
+	"github.com/go-git/go-git/v5/storage/filesystem"
+)
+
+// mirrorLocks are the locks of the mirrors in this process.
+// The mirrors are also locked with a lock file across processes.
+var mirrorLocks sync.Map // map[string]*sync.Mutex
+
+// gitMirror is a bare repository mirroring a remote repository,
+// which is shared by the checkouts of the same URL and credential.
+//
+// The mirrors are separated by the credential, as the workspaces can
+// resolve any object in the mirror without fetching it from the remote.
+// Otherwise, a checkout without the credential could read the objects
+// fetched with it.
+//
+// It holds the full history, so the fetches into it are incremental.
+// The workspaces use the objects in it with Git alternates.
+type gitMirror struct {
+	path       string
+	repository *git.Repository
+	remote     *git.Remote
+	unlock     func()
+}
+
+// openGitMirror locks and opens the mirror of url fetched with auth
+// in cacheDirectory. It must be closed to release the lock.
+func openGitMirror(cacheDirectory string, url string, auth transport.AuthMethod) (*gitMirror, error) {
+	if err := os.MkdirAll(cacheDirectory, 0o755); err != nil {
+		return nil, fmt.Errorf("create cache directory: %w", err)
+	}
+
+	sum := sha256.Sum256([]byte(url + "\n" + credentialIdentity(auth)))
+	path := filepath.Join(cacheDirectory, hex.EncodeToString(sum[:16])+".git")
+
+	mutex, _ := mirrorLocks.LoadOrStore(path, &sync.Mutex{})
+	mutex.(*sync.Mutex).Lock()
+
+	unlockFile, err := lockFile(path + ".lock")
+	if err != nil {
+		mutex.(*sync.Mutex).Unlock()
+		return nil, fmt.Errorf("lock mirror: %w", err)
+	}
+
+	m := &gitMirror{
+		path: path,
+		unlock: func() {
+			unlockFile()
+			mutex.(*sync.Mutex).Unlock()
+		},
+	}
+
+	if err := m.open(url); err != nil {
+		m.Close()
+		return nil, err
+	}
+
+	return m, nil
+}
+
+// credentialIdentity identifies the credential of auth.
+// It contains the secrets, so it must be hashed before being stored.
+func credentialIdentity(auth transport.AuthMethod) string {
+	switch auth := auth.(type) {
+	case nil:
+		return "anonymous"
+	case *http.TokenAuth:
+		return "token:" + auth.Token
+	case *http.BasicAuth:
+		return "basic:" + auth.Username + ":" + auth.Password
+	case *gitssh.PublicKeys:
+		return "ssh:" + auth.User + ":" + string(auth.Signer.PublicKey().Marshal())
+	default:
+		return fmt.Sprintf("%T:%s", auth, auth)
+	}
+}
+
+func (m *gitMirror) open(url string) error {
+	repository, err := git.PlainOpen(m.path)
+	if errors.Is(err, git.ErrRepositoryNotExists) {
+		repository, err = git.PlainInit(m.path, true)
+	}
+	if err != nil {
+		return fmt.Errorf("open mirror: %w", err)
+	}
+
+	remote, err := repository.Remote(git.DefaultRemoteName)
+	if errors.Is(err, git.ErrRemoteNotFound) {
+		remote, err = repository.CreateRemote(&config.RemoteConfig{
+			Name: git.DefaultRemoteName,
+			URLs: []string{url},
+		})
+	}
+	if err != nil {
+		return fmt.Errorf("open mirror remote: %w", err)
+	}
+
+	m.repository = repository
+	m.remote = remote
+	return nil
+}
+
+func (m *gitMirror) Close() {
+	m.unlock()
+}
+
+// InitWorkspace creates a repository in path using the objects of the mirror.
+func (m *gitMirror) InitWorkspace(path string) (*git.Repository, error) {
+	if _, err := git.PlainInit(path, false); err != nil {
+		return nil, err
+	}
+
+	dotGit := filepath.Join(path, git.GitDirName)
+	info := filepath.Join(dotGit, "objects", "info")
+	if err := os.MkdirAll(info, 0o755); err != nil {
+		return nil, err
+	}
+
+	objects, err := filepath.Abs(filepath.Join(m.path, "objects"))
+	if err != nil {
+		return nil, err
+	}
+	if err := os.WriteFile(filepath.Join(info, "alternates"), []byte(objects+"\n"), 0o644); err != nil {
+		return nil, err
+	}
+
+	// the alternates are absolute paths, which go-git
+	// only follows with a filesystem rooted at "/".
+	storage := filesystem.NewStorageWithOptions(
+		osfs.New(dotGit),
+		cache.NewObjectLRUDefault(),
+		filesystem.Options{AlternatesFS: osfs.New("/")},
+	)
+
+	return git.Open(storage, osfs.New(path))
+}
+
+// FetchInto fetches refSpec into the mirror with the full history,
+// and then copies the fetched refs to the workspace.
+func (m *gitMirror) FetchInto(ctx context.Context, workspace *git.Repository, refSpec config.RefSpec, auth transport.AuthMethod, progress io.Writer) error {
+	err := m.remote.FetchContext(ctx, &git.FetchOptions{
+		RefSpecs: []config.RefSpec{refSpec},
+		Depth:    0,
+		Auth:     auth,
+		Progress: progress,
+	})
+	if err != nil && !errors.Is(err, git.NoErrAlreadyUpToDate) {
+		return fmt.Errorf("fetch %s into mirror: %w", refSpec, err)
+	}
+
+	_, dst, _ := strings.Cut(refSpec.String(), ":")
+	matches := func(name plumbing.ReferenceName) bool {
+		if prefix, ok := strings.CutSuffix(dst, "*"); ok {
+			return strings.HasPrefix(name.String(), prefix)
+		}
+		return name.String() == dst
+	}
+
+	refs, err := m.repository.References()
+	if err != nil {
+		return fmt.Errorf("list mirror refs: %w", err)
+	}
+
+	return refs.ForEach(func(ref *plumbing.Reference) error {
+		if ref.Type() != plumbing.HashReference {
+			return nil
+		}
+
+		if !matches(ref.Name()) {
+			return nil
+		}
+
+		return workspace.Storer.SetReference(ref)
+	})
+}
@@ -0,0 +1,685 @@
+package procedures_test
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/cgi"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/stretchr/testify/assert"
+	zbaction "github.com/zeabur/action"
+	_ "github.com/zeabur/action/procedures"
+	"github.com/zeabur/action/procedures/procvariables"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+type testRepository struct {
+	URL string
+
+	Initial plumbing.Hash
+	Main    plumbing.Hash // api
+	Pull    plumbing.Hash
+}
+
+// newTestRepository creates a repository with the history:
+//
+//	initial (tag v1.0.0) -> main -> api (branch main)
+//	                     \-> pull (refs/pull/1/head)
+func newTestRepository(t *testing.T) testRepository {
+	dir := t.TempDir()
+
+	repository, err := git.PlainInitWithOptions(dir, &git.PlainInitOptions{
+		InitOptions: git.InitOptions{DefaultBranch: plumbing.Main},
+		Bare:        false,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	worktree, err := repository.Worktree()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	when := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	commit := func(file, message string) plumbing.Hash {
+		if err := os.MkdirAll(filepath.Dir(filepath.Join(dir, file)), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, file), []byte(message), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := worktree.Add(file); err != nil {
+			t.Fatal(err)
+		}
+
+		hash, err := worktree.Commit(message, &git.CommitOptions{
+			Author: &object.Signature{Name: "Tester", Email: "tester@example.com", When: when},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return hash
+	}
+
+	// allow fetching the commits by SHA like GitHub
+	cfg, err := repository.Config()
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg.Raw.Section("uploadpack").SetOption("allowAnySHA1InWant", "true")
+	if err := repository.SetConfig(cfg); err != nil {
+		t.Fatal(err)
+	}
+
+	r := testRepository{URL: "file://" + dir}
+
+	r.Initial = commit("initial.txt", "initial")
+	if _, err := repository.CreateTag("v1.0.0", r.Initial, &git.CreateTagOptions{
+		Tagger:  &object.Signature{Name: "Tester", Email: "tester@example.com", When: when},
+		Message: "v1.0.0",
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	r.Pull = commit("pull.txt", "pull")
+	if err := repository.Storer.SetReference(plumbing.NewHashReference("refs/pull/1/head", r.Pull)); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := worktree.Checkout(&git.CheckoutOptions{Hash: r.Initial, Force: true}); err != nil {
+		t.Fatal(err)
+	}
+	commit("main.txt", "main")
+	r.Main = commit("services/api/api.txt", "api")
+	if err := repository.Storer.SetReference(plumbing.NewHashReference(plumbing.Main, r.Main)); err != nil {
+		t.Fatal(err)
+	}
+	if err := repository.Storer.SetReference(plumbing.NewSymbolicReference(plumbing.HEAD, plumbing.Main)); err != nil {
+		t.Fatal(err)
+	}
+
+	return r
+}
+
+func TestCheckout(t *testing.T) {
+	repository := newTestRepository(t)
+
+	testcases := []struct {
+		name     string
+		with     zbaction.ProcStepArgs
+		expected plumbing.Hash
+		ref      string
+		file     string
+	}{
+		{"default branch", zbaction.ProcStepArgs{}, repository.Main, "refs/heads/main", "main.txt"},
+		{"branch", zbaction.ProcStepArgs{"branch": "main"}, repository.Main, "refs/heads/main", "main.txt"},
+		{"tag", zbaction.ProcStepArgs{"ref": "v1.0.0"}, repository.Initial, "refs/tags/v1.0.0", "initial.txt"},
+		{"pull request", zbaction.ProcStepArgs{"ref": "refs/pull/1/head"}, repository.Pull, "refs/pull/1/head", "pull.txt"},
+		{"sha", zbaction.ProcStepArgs{"sha": repository.Pull.String()}, repository.Pull, "", "pull.txt"},
+		{"ref and sha", zbaction.ProcStepArgs{"ref": "main", "sha": repository.Initial.String()[:10], "depth": "0"}, repository.Initial, "refs/heads/main", "initial.txt"},
+	}
+
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			tc.with["url"] = repository.URL
+			stdout := &bytes.Buffer{}
+
+			err := zbaction.RunAction(context.Background(), zbaction.Action{
+				Jobs: []zbaction.Job{
+					{
+						Steps: []zbaction.Step{
+							{
+								ID:           "checkout",
+								RunnableStep: zbaction.ProcStep{Uses: "action/checkout", With: tc.with},
+							},
+							{
+								RunnableStep: zbaction.CommandStep{
+									Command: []string{"echo", "${out.checkout.ref}|${out.checkout.sha}|${out.checkout.shortSha}|${out.checkout.author}|${out.checkout.timestamp}"},
+								},
+							},
+							{
+								RunnableStep: zbaction.CommandStep{
+									Command: []string{"test", "-f", tc.file},
+								},
+							},
+						},
+					},
+				},
+			}, zbaction.WithCustomStdout(stdout))
+
+			assert.NoError(t, err)
+			assert.Equal(t, tc.ref+"|"+tc.expected.String()+"|"+tc.expected.String()[:7]+"|Tester <tester@example.com>|2024-01-02T03:04:05Z\n", stdout.String())
+		})
+	}
+}
+
+func runCheckout(t *testing.T, steps ...zbaction.Step) (string, error) {
+	stdout := &bytes.Buffer{}
+
+	err := zbaction.RunAction(context.Background(), zbaction.Action{
+		Jobs: []zbaction.Job{{Steps: steps}},
+	}, zbaction.WithCustomStdout(stdout))
+
+	return stdout.String(), err
+}
+
+func TestCheckout_Path(t *testing.T) {
+	repository := newTestRepository(t)
+
+	stdout, err := runCheckout(t,
+		zbaction.Step{
+			ID: "main",
+			RunnableStep: zbaction.ProcStep{Uses: "action/checkout", With: zbaction.ProcStepArgs{
+				"url":  repository.URL,
+				"path": "repos/main",
+			}},
+		},
+		zbaction.Step{
+			ID: "pull",
+			RunnableStep: zbaction.ProcStep{Uses: "action/checkout", With: zbaction.ProcStepArgs{
+				"url":  repository.URL,
+				"ref":  "refs/pull/1/head",
+				"path": "repos/pull",
+			}},
+		},
+		zbaction.Step{
+			RunnableStep: zbaction.CommandStep{
+				Command: []string{"test", "-f", "repos/main/main.txt", "-a", "-f", "repos/pull/pull.txt"},
+			},
+		},
+		zbaction.Step{
+			RunnableStep: zbaction.CommandStep{
+				Command: []string{"echo", "${out.pull.path}"},
+			},
+		},
+	)
+
+	assert.NoError(t, err)
+	assert.True(t, strings.HasSuffix(stdout, "/repos/pull\n"), stdout)
+}
+
+func TestCheckout_PathOutsideRoot(t *testing.T) {
+	repository := newTestRepository(t)
+
+	_, err := runCheckout(t, zbaction.Step{
+		RunnableStep: zbaction.ProcStep{Uses: "action/checkout", With: zbaction.ProcStepArgs{
+			"url":  repository.URL,
+			"path": "../outside",
+		}},
+	})
+
+	assert.ErrorAs(t, err, &zbaction.ErrPathOutsideRoot{})
+}
+
+// newHTTPGitServer serves the repository over the smart HTTP protocol
+// to the requests with the authorization header.
+func newHTTPGitServer(t *testing.T, repository testRepository, authorization string) string {
+	gitPath, err := exec.LookPath("git")
+	if err != nil {
+		t.Skip("git is not installed")
+	}
+
+	backend := &cgi.Handler{
+		Path: gitPath,
+		Args: []string{"http-backend"},
+		Env:  []string{"GIT_PROJECT_ROOT=" + strings.TrimPrefix(repository.URL, "file://"), "GIT_HTTP_EXPORT_ALL=1"},
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != authorization {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		backend.ServeHTTP(w, r)
+	}))
+	t.Cleanup(server.Close)
+
+	return server.URL + "/.git"
+}
+
+func TestCheckout_HTTPAuth(t *testing.T) {
+	repository := newTestRepository(t)
+
+	testcases := []struct {
+		name          string
+		with          zbaction.ProcStepArgs
+		authorization string
+	}{
+		{"token", zbaction.ProcStepArgs{"authToken": "s3cret"}, "Bearer s3cret"},
+		{"basic", zbaction.ProcStepArgs{"authUsername": "tester", "authPassword": "p@ss"}, "Basic " + base64.StdEncoding.EncodeToString([]byte("tester:p@ss"))},
+	}
+
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			url := newHTTPGitServer(t, repository, tc.authorization)
+
+			tc.with["url"] = url
+			_, err := runCheckout(t,
+				zbaction.Step{
+					RunnableStep: zbaction.ProcStep{Uses: "action/checkout", With: tc.with},
+				},
+				zbaction.Step{
+					RunnableStep: zbaction.CommandStep{Command: []string{"test", "-f", "main.txt"}},
+				},
+			)
+			assert.NoError(t, err)
+
+			_, err = runCheckout(t, zbaction.Step{
+				RunnableStep: zbaction.ProcStep{Uses: "action/checkout", With: zbaction.ProcStepArgs{"url": url}},
+			})
+			assert.Error(t, err)
+		})
+	}
+}
+
+// newSSHGitServer serves git-upload-pack over SSH to the clients with
+// authorizedKey, and returns its address and its known_hosts entry.
+func newSSHGitServer(t *testing.T, authorizedKey ssh.PublicKey) (string, string) {
+	_, hostKey, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hostSigner, err := ssh.NewSignerFromKey(hostKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	config := &ssh.ServerConfig{
+		PublicKeyCallback: func(_ ssh.ConnMetadata, key ssh.PublicKey) (*ssh.Permissions, error) {
+			if !bytes.Equal(key.Marshal(), authorizedKey.Marshal()) {
+				return nil, errors.New("unauthorized key")
+			}
+			return nil, nil
+		},
+	}
+	config.AddHostKey(hostSigner)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		_ = listener.Close()
+	})
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go serveSSHGit(conn, config)
+		}
+	}()
+
+	address := listener.Addr().String()
+	return address, knownhosts.Line([]string{knownhosts.Normalize(address)}, hostSigner.PublicKey())
+}
+
+// serveSSHGit runs the git command requested in each session of conn.
+func serveSSHGit(conn net.Conn, config *ssh.ServerConfig) {
+	defer func() {
+		_ = conn.Close()
+	}()
+
+	_, channels, requests, err := ssh.NewServerConn(conn, config)
+	if err != nil {
+		return
+	}
+	go ssh.DiscardRequests(requests)
+
+	for newChannel := range channels {
+		if newChannel.ChannelType() != "session" {
+			_ = newChannel.Reject(ssh.UnknownChannelType, "not a session")
+			continue
+		}
+
+		channel, channelRequests, err := newChannel.Accept()
+		if err != nil {
+			return
+		}
+
+		go func() {
+			defer func() {
+				_ = channel.Close()
+			}()
+
+			for req := range channelRequests {
+				if req.Type != "exec" {
+					_ = req.Reply(req.Type == "env", nil)
+					continue
+				}
+
+				var payload struct{ Command string }
+				if err := ssh.Unmarshal(req.Payload, &payload); err != nil {
+					_ = req.Reply(false, nil)
+					return
+				}
+				_ = req.Reply(true, nil)
+
+				// e.g. git-upload-pack '/path/to/repository'
+				name, path, _ := strings.Cut(payload.Command, " ")
+				cmd := exec.Command(name, strings.Trim(path, "'"))
+				cmd.Stdout = channel
+				cmd.Stderr = channel.Stderr()
+				stdin, err := cmd.StdinPipe()
+				if err != nil {
+					return
+				}
+				go func() {
+					_, _ = io.Copy(stdin, channel)
+					_ = stdin.Close()
+				}()
+
+				status := struct{ Status uint32 }{0}
+				if err := cmd.Run(); err != nil {
+					status.Status = 1
+				}
+				_, _ = channel.SendRequest("exit-status", false, ssh.Marshal(status))
+				return
+			}
+		}()
+	}
+}
+
+func TestCheckout_SSHKey(t *testing.T) {
+	repository := newTestRepository(t)
+
+	_, err := runCheckout(t, zbaction.Step{
+		RunnableStep: zbaction.ProcStep{Uses: "action/checkout", With: zbaction.ProcStepArgs{
+			"url":    repository.URL,
+			"sshKey": "not a key",
+		}},
+	})
+	assert.ErrorContains(t, err, "parse ssh key")
+
+	publicKey, privateKey, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(privateKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})
+
+	_, err = runCheckout(t, zbaction.Step{
+		RunnableStep: zbaction.ProcStep{Uses: "action/checkout", With: zbaction.ProcStepArgs{
+			"url":        repository.URL,
+			"sshKey":     string(key),
+			"knownHosts": "invalid known hosts",
+		}},
+	})
+	assert.ErrorContains(t, err, "load known hosts")
+
+	authorizedKey, err := ssh.NewPublicKey(publicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	address, knownHosts := newSSHGitServer(t, authorizedKey)
+	url := "ssh://git@" + address + strings.TrimPrefix(repository.URL, "file://")
+
+	stdout, err := runCheckout(t,
+		zbaction.Step{
+			ID: "checkout",
+			RunnableStep: zbaction.ProcStep{Uses: "action/checkout", With: zbaction.ProcStepArgs{
+				"url":        url,
+				"sshKey":     string(key),
+				"knownHosts": knownHosts,
+			}},
+		},
+		zbaction.Step{
+			RunnableStep: zbaction.CommandStep{Command: []string{"echo", "${out.checkout.sha}"}},
+		},
+	)
+	assert.NoError(t, err)
+	assert.Equal(t, repository.Main.String()+"\n", stdout)
+
+	// the host key is verified
+	_, otherHostKey, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherSigner, err := ssh.NewSignerFromKey(otherHostKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = runCheckout(t, zbaction.Step{
+		RunnableStep: zbaction.ProcStep{Uses: "action/checkout", With: zbaction.ProcStepArgs{
+			"url":        url,
+			"sshKey":     string(key),
+			"knownHosts": knownhosts.Line([]string{knownhosts.Normalize(address)}, otherSigner.PublicKey()),
+		}},
+	})
+	assert.ErrorContains(t, err, "key mismatch")
+}
+
+// newSubmoduleRepository creates a repository app with the submodule lib,
+// which has the nested submodule leaf, and returns the URL of app.
+func newSubmoduleRepository(t *testing.T) string {
+	base := t.TempDir()
+
+	gitCommand := func(dir string, args ...string) {
+		cmd := exec.Command("git", append([]string{
+			"-c", "user.name=Tester",
+			"-c", "user.email=tester@example.com",
+			"-c", "init.defaultBranch=main",
+			"-c", "protocol.file.allow=always",
+		}, args...)...)
+		cmd.Dir = dir
+		if output, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("git %s: %s", strings.Join(args, " "), output)
+		}
+	}
+
+	for _, repository := range []struct{ name, submodule string }{
+		{"leaf", ""},
+		{"lib", "leaf"},
+		{"app", "lib"},
+	} {
+		dir := filepath.Join(base, repository.name)
+
+		gitCommand(base, "init", "-q", repository.name)
+		if err := os.WriteFile(filepath.Join(dir, repository.name+".txt"), []byte(repository.name), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		gitCommand(dir, "add", ".")
+		if repository.submodule != "" {
+			gitCommand(dir, "submodule", "add", "-q", "file://"+filepath.Join(base, repository.submodule), repository.submodule)
+		}
+		gitCommand(dir, "commit", "-q", "-m", repository.name)
+	}
+
+	return "file://" + filepath.Join(base, "app")
+}
+
+func TestCheckout_Submodules(t *testing.T) {
+	url := newSubmoduleRepository(t)
+
+	testcases := []struct {
+		mode     string
+		expected string
+	}{
+		{"none", "./app.txt\n"},
+		{"top-level", "./app.txt\n./lib/lib.txt\n"},
+		{"recursive", "./app.txt\n./lib/leaf/leaf.txt\n./lib/lib.txt\n"},
+	}
+
+	for _, tc := range testcases {
+		t.Run(tc.mode, func(t *testing.T) {
+			stdout, err := runCheckout(t,
+				zbaction.Step{
+					RunnableStep: zbaction.ProcStep{Uses: "action/checkout", With: zbaction.ProcStepArgs{
+						"url":        url,
+						"submodules": tc.mode,
+					}},
+				},
+				zbaction.Step{
+					RunnableStep: zbaction.CommandStep{Command: []string{"sh", "-c", "find . -name '*.txt' | sort"}},
+				},
+			)
+
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expected, stdout)
+		})
+	}
+}
+
+func TestCheckout_Depth(t *testing.T) {
+	repository := newTestRepository(t)
+
+	testcases := []struct {
+		depth    string
+		expected string
+	}{
+		{"1", "1\n"},
+		{"2", "2\n"},
+		{"0", "3\n"},
+	}
+
+	for _, tc := range testcases {
+		t.Run(tc.depth, func(t *testing.T) {
+			stdout, err := runCheckout(t,
+				zbaction.Step{
+					RunnableStep: zbaction.ProcStep{Uses: "action/checkout", With: zbaction.ProcStepArgs{
+						"url":   repository.URL,
+						"depth": tc.depth,
+					}},
+				},
+				zbaction.Step{
+					RunnableStep: zbaction.CommandStep{Command: []string{"git", "rev-list", "--count", "HEAD"}},
+				},
+			)
+
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expected, stdout)
+		})
+	}
+}
+
+func TestCheckout_Sparse(t *testing.T) {
+	repository := newTestRepository(t)
+
+	_, err := runCheckout(t,
+		zbaction.Step{
+			RunnableStep: zbaction.ProcStep{Uses: "action/checkout", With: zbaction.ProcStepArgs{
+				"url":        repository.URL,
+				"sparse":     "services/api",
+				"submodules": "none",
+				"depth":      "0",
+			}},
+		},
+		zbaction.Step{
+			RunnableStep: zbaction.CommandStep{
+				Command: []string{"test", "-f", "services/api/api.txt", "-a", "!", "-e", "main.txt"},
+			},
+		},
+	)
+
+	assert.NoError(t, err)
+}
+
+func TestCheckout_InvalidArguments(t *testing.T) {
+	testcases := []zbaction.ProcStepArgs{
+		{"depth": "-1"},
+		{"depth": "many"},
+		{"submodules": "some"},
+		{"sparse": "../outside"},
+		{"sparse": "/"},
+	}
+
+	for _, with := range testcases {
+		with["url"] = "https://example.com/repo.git"
+
+		_, err := zbaction.ResolveProcedure("action/checkout", with)
+		assert.ErrorAs(t, err, &zbaction.ErrInvalidArgument{}, with)
+	}
+
+	// the arguments with variables are validated when running
+	repository := newTestRepository(t)
+	_, err := runCheckout(t, zbaction.Step{
+		Variables: map[string]string{"depth": "many"},
+		RunnableStep: zbaction.ProcStep{Uses: "action/checkout", With: zbaction.ProcStepArgs{
+			"url":   repository.URL,
+			"depth": "${depth}",
+		}},
+	})
+	assert.ErrorAs(t, err, &zbaction.ErrInvalidArgument{})
+}
+
+func TestCheckout_CacheDirectory(t *testing.T) {
+	repository := newTestRepository(t)
+	cacheDirectory := t.TempDir()
+
+	checkout := func(id, path string, with zbaction.ProcStepArgs) zbaction.Step {
+		with["url"] = repository.URL
+		with["path"] = path
+
+		return zbaction.Step{
+			ID:           id,
+			RunnableStep: zbaction.ProcStep{Uses: "action/checkout", With: with},
+		}
+	}
+
+	stdout := &bytes.Buffer{}
+	err := zbaction.RunAction(context.Background(), zbaction.Action{
+		Jobs: []zbaction.Job{
+			{
+				ID: "first",
+				Steps: []zbaction.Step{
+					checkout("main", "main", zbaction.ProcStepArgs{}),
+					checkout("initial", "initial", zbaction.ProcStepArgs{"sha": repository.Initial.String()}),
+				},
+			},
+			{
+				ID: "second",
+				Steps: []zbaction.Step{
+					checkout("tag", "tag", zbaction.ProcStepArgs{"ref": "v1.0.0"}),
+					{
+						RunnableStep: zbaction.CommandStep{
+							Command: []string{"git", "-C", "tag", "rev-parse", "HEAD"},
+						},
+					},
+				},
+			},
+			{
+				ID: "authenticated",
+				Steps: []zbaction.Step{
+					checkout("main", "main", zbaction.ProcStepArgs{"authUsername": "tester", "authPassword": "p@ssw0rd"}),
+				},
+			},
+		},
+	}, zbaction.WithCustomStdout(stdout), procvariables.WithCheckoutCacheDirectory(cacheDirectory))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, repository.Initial.String()+"\n", stdout.String())
+
+	mirrors, err := filepath.Glob(filepath.Join(cacheDirectory, "*.git"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the checkouts with another credential use another mirror
+	assert.Len(t, mirrors, 2)
+}
@@ -2,37 +2,333 @@ package procedures
 
 import (
 	"context"
-	"path"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
 
+	"github.com/moby/patternmatcher"
+	"github.com/moby/patternmatcher/ignorefile"
 	cp "github.com/otiai10/copy"
 	zbaction "github.com/zeabur/action"
 )
 
+// SymlinkPolicy is how action/copy-local-dir copies the symlinks.
+type SymlinkPolicy string
+
+const (
+	// SymlinkPolicySkip does not copy the symlinks.
+	SymlinkPolicySkip SymlinkPolicy = "skip"
+	// SymlinkPolicyShallow copies the symlinks as symlinks.
+	SymlinkPolicyShallow SymlinkPolicy = "shallow"
+	// SymlinkPolicyDeep copies the files the symlinks point to,
+	// including the files outside the source directory.
+	SymlinkPolicyDeep SymlinkPolicy = "deep"
+)
+
 func init() {
-	zbaction.RegisterProcedure("action/copy-local-dir", func(args zbaction.ProcStepArgs) (zbaction.ProcedureStep, error) {
-		src := args["src"]
-		if src == "" {
-			return nil, zbaction.NewErrRequiredArgument("src")
+	zbaction.RegisterProcedureWithSchema("action/copy-local-dir", &zbaction.ProcedureSchema{
+		Description: "Copy a local directory into the job root.",
+		Arguments: []zbaction.ArgumentSchema{
+			{Name: "src", Required: true, Description: "The local directory to copy from."},
+			{Name: "dest", Required: true, Description: "The destination, relative to the job root. It must not lead outside the job root, even through symlinks."},
+			{Name: "include", Description: "The patterns of the files to copy, separated by newlines or commas, in the `.dockerignore` syntax. By default, all the files are copied. The directories are not filtered."},
+			{Name: "exclude", Description: "The patterns of the files and directories not to copy, separated by newlines or commas, in the `.dockerignore` syntax. `!` re-includes the files excluded by the previous patterns."},
+			{Name: "ignoreFile", Description: "The ignore file in `src` whose patterns are added to `exclude`, such as `.dockerignore`. It is skipped if it does not exist."},
+			{Name: "symlinks", Default: string(SymlinkPolicyShallow), Enum: []string{string(SymlinkPolicySkip), string(SymlinkPolicyShallow), string(SymlinkPolicyDeep)}, Description: "How to copy the symlinks: `skip` them, copy them as symlinks (`shallow`), or copy the files they point to (`deep`). " +
+				"With `deep`, the files outside `src` the symlinks point to are copied as well."},
+		},
+		Outputs: []zbaction.OutputSchema{
+			{Name: "files", Description: "The number of the regular files copied."},
+			{Name: "bytes", Description: "The total size of the regular files copied, in bytes."},
+		},
+		Examples: []zbaction.ProcedureExample{
+			{
+				Description: "Copy the source code into the job root.",
+				With: zbaction.ProcStepArgs{
+					"src":  "/srv/source",
+					"dest": ".",
+				},
+			},
+			{
+				Description: "Copy the source code without the dependencies and the files in `.dockerignore`.",
+				With: zbaction.ProcStepArgs{
+					"src":        "/srv/source",
+					"dest":       "src",
+					"exclude":    ".git, node_modules",
+					"ignoreFile": ".dockerignore",
+				},
+			},
+		},
+	}, func(args zbaction.ProcStepArgs) (zbaction.ProcedureStep, error) {
+		if symlinks := args["symlinks"]; !strings.Contains(symlinks, "$") {
+			if _, err := parseSymlinkPolicy(symlinks); err != nil {
+				return nil, err
+			}
 		}
-
-		dest := args["dest"]
-		if dest == "" {
-			return nil, zbaction.NewErrRequiredArgument("dest")
+		for _, key := range []string{"include", "exclude"} {
+			if patterns := args[key]; !strings.Contains(patterns, "$") {
+				if _, err := newPatternMatcher(key, splitPatterns(patterns)); err != nil {
+					return nil, err
+				}
+			}
 		}
 
 		return &CopyLocalDirAction{
-			Src:  zbaction.NewArgumentStr(src),
-			Dest: zbaction.NewArgumentStr(dest),
+			Src:        zbaction.NewArgumentStr(args["src"]),
+			Dest:       zbaction.NewArgumentStr(args["dest"]),
+			Include:    zbaction.NewArgumentStr(args["include"]),
+			Exclude:    zbaction.NewArgumentStr(args["exclude"]),
+			IgnoreFile: zbaction.NewArgumentStr(args["ignoreFile"]),
+			Symlinks:   zbaction.NewArgumentStr(args["symlinks"]),
 		}, nil
 	})
 }
 
 type CopyLocalDirAction struct {
-	Src  zbaction.Argument[string]
-	Dest zbaction.Argument[string]
+	Src        zbaction.Argument[string]
+	Dest       zbaction.Argument[string]
+	Include    zbaction.Argument[string]
+	Exclude    zbaction.Argument[string]
+	IgnoreFile zbaction.Argument[string]
+	Symlinks   zbaction.Argument[string]
 }
 
 func (c CopyLocalDirAction) Run(_ context.Context, sc *zbaction.StepContext) (zbaction.CleanupFn, error) {
-	err := cp.Copy(c.Src.Value(sc.ExpandString), path.Join(sc.Root(), c.Dest.Value(sc.ExpandString)))
-	return nil, err
+	src := c.Src.Value(sc.ExpandString)
+
+	// dest may be under a symlink in the job root, such as one in a checked out repository
+	dest, err := zbaction.ResolveRealPath(sc.Root(), c.Dest.Value(sc.ExpandString))
+	if err != nil {
+		return nil, err
+	}
+
+	symlinkPolicy, err := parseSymlinkPolicy(c.Symlinks.Value(sc.ExpandString))
+	if err != nil {
+		return nil, err
+	}
+
+	includes, err := newPatternMatcher("include", splitPatterns(c.Include.Value(sc.ExpandString)))
+	if err != nil {
+		return nil, err
+	}
+
+	excludePatterns := splitPatterns(c.Exclude.Value(sc.ExpandString))
+	if ignoreFile := c.IgnoreFile.Value(sc.ExpandString); ignoreFile != "" {
+		patterns, err := readIgnoreFile(filepath.Join(src, ignoreFile))
+		if err != nil {
+			return nil, err
+		}
+		excludePatterns = append(excludePatterns, patterns...)
+	}
+	excludes, err := newPatternMatcher("exclude", excludePatterns)
+	if err != nil {
+		return nil, err
+	}
+
+	copier := &localDirCopier{
+		symlinkPolicy: symlinkPolicy,
+		includes:      includes,
+		excludes:      excludes,
+	}
+	realSrc, err := filepath.EvalSymlinks(src)
+	if err != nil {
+		return nil, fmt.Errorf("resolve src: %w", err)
+	}
+	if err := cp.Copy(src, dest, copier.options(src, "", []string{realSrc})); err != nil {
+		return nil, err
+	}
+
+	sc.SetThisOutput("files", strconv.Itoa(copier.files))
+	sc.SetThisOutput("bytes", strconv.FormatInt(copier.bytes, 10))
+
+	return nil, nil
+}
+
+// localDirCopier copies a directory with the filters and the symlink policy,
+// and counts the copied files.
+type localDirCopier struct {
+	symlinkPolicy SymlinkPolicy
+	includes      *patternmatcher.PatternMatcher
+	excludes      *patternmatcher.PatternMatcher
+
+	files int
+	bytes int64
+}
+
+// options gets the options to copy the directory root,
+// whose files are filtered as they are in the directory relRoot of the source.
+//
+// descent is the resolved directories copied on the way to root,
+// which the deep symlinks in root must not point to again.
+func (c *localDirCopier) options(root string, relRoot string, descent []string) cp.Options {
+	return cp.Options{
+		OnSymlink: func(string) cp.SymlinkAction {
+			// the deep symlinks are copied in Skip instead,
+			// as cp resolves the relative symlinks against the working directory.
+			if c.symlinkPolicy == SymlinkPolicyShallow {
+				return cp.Shallow
+			}
+			return cp.Skip
+		},
+		Skip: func(srcinfo os.FileInfo, src, dest string) (bool, error) {
+			rel, err := filepath.Rel(root, src)
+			if err != nil {
+				return false, err
+			}
+			rel = filepath.ToSlash(filepath.Join(relRoot, rel))
+			if rel == "." {
+				return false, nil
+			}
+
+			if srcinfo.Mode()&os.ModeSymlink != 0 && c.symlinkPolicy == SymlinkPolicyDeep {
+				return true, c.copyDeepSymlink(src, dest, rel, descent)
+			}
+
+			return c.skip(rel, srcinfo.IsDir())
+		},
+		WrapReader: func(r io.Reader) io.Reader {
+			c.files++
+			return countingReader{r: r, n: &c.bytes}
+		},
+	}
+}
+
+func (c *localDirCopier) skip(rel string, isDir bool) (bool, error) {
+	if c.excludes != nil {
+		excluded, err := c.excludes.MatchesOrParentMatches(rel)
+		if err != nil {
+			return false, err
+		}
+
+		// the excluded directories are walked into
+		// if some files in them may be re-included.
+		if excluded && !(isDir && c.excludes.Exclusions()) {
+			return true, nil
+		}
+	}
+
+	if c.includes != nil && !isDir {
+		included, err := c.includes.MatchesOrParentMatches(rel)
+		if err != nil {
+			return false, err
+		}
+		return !included, nil
+	}
+
+	return false, nil
+}
+
+// copyDeepSymlink copies the file or the directory the symlink src points to.
+//
+// It fails if the symlink points to a directory containing it,
+// or a directory on the descent, which would be copied endlessly.
+func (c *localDirCopier) copyDeepSymlink(src, dest, rel string, descent []string) error {
+	target, err := filepath.EvalSymlinks(src)
+	if err != nil {
+		return fmt.Errorf("resolve symlink %s: %w", rel, err)
+	}
+
+	info, err := os.Stat(target)
+	if err != nil {
+		return err
+	}
+
+	if info.IsDir() {
+		parent, err := filepath.EvalSymlinks(filepath.Dir(src))
+		if err != nil {
+			return err
+		}
+		if parent == target || strings.HasPrefix(parent, target+string(filepath.Separator)) {
+			return fmt.Errorf("symlink %s points to its parent directory", rel)
+		}
+		if slices.Contains(descent, target) {
+			return fmt.Errorf("symlink %s forms a loop through %s", rel, target)
+		}
+	}
+
+	if skip, err := c.skip(rel, info.IsDir()); skip || err != nil {
+		return err
+	}
+
+	return cp.Copy(target, dest, c.options(target, rel, append(slices.Clip(descent), target)))
+}
+
+// countingReader counts the bytes read from r into n.
+type countingReader struct {
+	r io.Reader
+	n *int64
+}
+
+func (c countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	*c.n += int64(n)
+	return n, err
+}
+
+func parseSymlinkPolicy(s string) (SymlinkPolicy, error) {
+	switch policy := SymlinkPolicy(s); policy {
+	case SymlinkPolicySkip, SymlinkPolicyShallow, SymlinkPolicyDeep:
+		return policy, nil
+	case "":
+		return SymlinkPolicyShallow, nil
+	default:
+		return "", zbaction.NewErrInvalidArgument("symlinks", "unknown symlink policy: "+s)
+	}
+}
+
+// splitPatterns splits the patterns separated by newlines or commas.
+func splitPatterns(s string) []string {
+	fields := strings.FieldsFunc(s, func(r rune) bool {
+		return r == '\n' || r == ','
+	})
+
+	patterns := make([]string, 0, len(fields))
+	for _, field := range fields {
+		if pattern := strings.TrimSpace(field); pattern != "" {
+			patterns = append(patterns, pattern)
+		}
+	}
+
+	return patterns
+}
+
+// newPatternMatcher creates a matcher of the patterns of the argument key.
+// It returns nil if there are no patterns.
+func newPatternMatcher(key string, patterns []string) (*patternmatcher.PatternMatcher, error) {
+	if len(patterns) == 0 {
+		return nil, nil
+	}
+
+	pm, err := patternmatcher.New(patterns)
+	if err != nil {
+		return nil, zbaction.NewErrInvalidArgument(key, err.Error())
+	}
+
+	return pm, nil
+}
+
+// readIgnoreFile reads the patterns of a `.dockerignore` style file.
+// It returns no patterns if the file does not exist.
+func readIgnoreFile(path string) ([]string, error) {
+	f, err := os.Open(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("open ignore file: %w", err)
+	}
+	defer f.Close()
+
+	patterns, err := ignorefile.ReadAll(f)
+	if err != nil {
+		return nil, fmt.Errorf("read ignore file: %w", err)
+	}
+
+	return patterns, nil
 }
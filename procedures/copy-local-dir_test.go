@@ -0,0 +1,252 @@
+package procedures_test
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	zbaction "github.com/zeabur/action"
+)
+
+func newTestSourceDir(t *testing.T) string {
+	dir := t.TempDir()
+
+	files := map[string]string{
+		"a.txt":                "a",
+		"b.md":                 "bb",
+		"sub/c.txt":            "ccc",
+		".git/HEAD":            "ref: refs/heads/main",
+		"node_modules/x/x.js":  "x",
+		"node_modules/keep.js": "keep",
+		".dockerignore":        "# docs\n*.md\n",
+	}
+	for name, content := range files {
+		if err := os.MkdirAll(filepath.Dir(filepath.Join(dir, name)), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Symlink("a.txt", filepath.Join(dir, "link")); err != nil {
+		t.Fatal(err)
+	}
+
+	return dir
+}
+
+func TestCopyLocalDir(t *testing.T) {
+	src := newTestSourceDir(t)
+
+	testcases := []struct {
+		name     string
+		with     zbaction.ProcStepArgs
+		expected string
+	}{
+		{
+			"default",
+			zbaction.ProcStepArgs{},
+			"7|43\n" +
+				"f out/.dockerignore\nf out/.git/HEAD\nf out/a.txt\nf out/b.md\n" +
+				"f out/node_modules/keep.js\nf out/node_modules/x/x.js\nf out/sub/c.txt\nl out/link\n",
+		},
+		{
+			"exclude",
+			zbaction.ProcStepArgs{
+				"exclude":    ".git, node_modules\n!node_modules/keep.js",
+				"ignoreFile": ".dockerignore",
+				"symlinks":   "skip",
+			},
+			"4|20\n" +
+				"f out/.dockerignore\nf out/a.txt\nf out/node_modules/keep.js\nf out/sub/c.txt\n",
+		},
+		{
+			"include",
+			zbaction.ProcStepArgs{
+				"include":  "**/*.txt",
+				"exclude":  "node_modules",
+				"symlinks": "deep",
+			},
+			"2|4\n" +
+				"f out/a.txt\nf out/sub/c.txt\n",
+		},
+		{
+			"deep",
+			zbaction.ProcStepArgs{
+				"include":  "link",
+				"symlinks": "deep",
+			},
+			"1|1\n" +
+				"f out/link\n",
+		},
+		{
+			"missing ignore file",
+			zbaction.ProcStepArgs{
+				"include":    "a.txt",
+				"ignoreFile": ".gitignore",
+			},
+			"1|1\n" +
+				"f out/a.txt\n",
+		},
+	}
+
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			tc.with["src"] = src
+			tc.with["dest"] = "out"
+			stdout := &bytes.Buffer{}
+
+			err := zbaction.RunAction(context.Background(), zbaction.Action{
+				Jobs: []zbaction.Job{
+					{
+						Steps: []zbaction.Step{
+							{
+								ID:           "copy",
+								RunnableStep: zbaction.ProcStep{Uses: "action/copy-local-dir", With: tc.with},
+							},
+							{
+								RunnableStep: zbaction.CommandStep{
+									Command: []string{"echo", "${out.copy.files}|${out.copy.bytes}"},
+								},
+							},
+							{
+								RunnableStep: zbaction.CommandStep{
+									Command: []string{"sh", "-c", "find out ! -type d -printf '%y %p\\n' | LC_ALL=C sort"},
+								},
+							},
+						},
+					},
+				},
+			}, zbaction.WithCustomStdout(stdout))
+
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expected, stdout.String())
+		})
+	}
+}
+
+func TestCopyLocalDir_SymlinkedDest(t *testing.T) {
+	src := newTestSourceDir(t)
+	outside := t.TempDir()
+
+	_, err := runCheckout(t,
+		zbaction.Step{
+			// e.g. a symlink in a checked out repository
+			RunnableStep: zbaction.CommandStep{Command: []string{"ln", "-s", outside, "out"}},
+		},
+		zbaction.Step{
+			RunnableStep: zbaction.ProcStep{Uses: "action/copy-local-dir", With: zbaction.ProcStepArgs{
+				"src":  src,
+				"dest": "out/src",
+			}},
+		},
+	)
+	assert.ErrorAs(t, err, &zbaction.ErrPathOutsideRoot{})
+
+	entries, err := os.ReadDir(outside)
+	assert.NoError(t, err)
+	assert.Empty(t, entries)
+
+	// the symlinks inside the job root are followed
+	stdout, err := runCheckout(t,
+		zbaction.Step{
+			RunnableStep: zbaction.CommandStep{Command: []string{"sh", "-c", "mkdir inside && ln -s inside out"}},
+		},
+		zbaction.Step{
+			RunnableStep: zbaction.ProcStep{Uses: "action/copy-local-dir", With: zbaction.ProcStepArgs{
+				"src":     src,
+				"dest":    "out/src",
+				"include": "a.txt",
+			}},
+		},
+		zbaction.Step{
+			RunnableStep: zbaction.CommandStep{Command: []string{"cat", "inside/src/a.txt"}},
+		},
+	)
+	assert.NoError(t, err)
+	assert.Equal(t, "a", stdout)
+}
+
+func TestCopyLocalDir_InvalidArguments(t *testing.T) {
+	src := newTestSourceDir(t)
+
+	for _, with := range []zbaction.ProcStepArgs{
+		{"src": src, "dest": "../out"},
+		{"src": src, "dest": "out", "symlinks": "follow"},
+		{"src": src, "dest": "out", "exclude": "[a-"},
+	} {
+		_, err := runCheckout(t, zbaction.Step{
+			RunnableStep: zbaction.ProcStep{Uses: "action/copy-local-dir", With: with},
+		})
+
+		assert.Error(t, err, with)
+	}
+}
+
+func TestCopyLocalDir_DeepDirectory(t *testing.T) {
+	src := newTestSourceDir(t)
+	if err := os.Symlink("sub", filepath.Join(src, "linkdir")); err != nil {
+		t.Fatal(err)
+	}
+
+	stdout, err := runCheckout(t,
+		zbaction.Step{
+			RunnableStep: zbaction.ProcStep{Uses: "action/copy-local-dir", With: zbaction.ProcStepArgs{
+				"src":      src,
+				"dest":     "out",
+				"include":  "linkdir",
+				"symlinks": "deep",
+			}},
+		},
+		zbaction.Step{
+			RunnableStep: zbaction.CommandStep{
+				Command: []string{"sh", "-c", "find out ! -type d -printf '%y %p\\n' | LC_ALL=C sort"},
+			},
+		},
+	)
+
+	assert.NoError(t, err)
+	assert.Equal(t, "f out/linkdir/c.txt\n", stdout)
+
+	if err := os.Symlink(".", filepath.Join(src, "sub", "loop")); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = runCheckout(t, zbaction.Step{
+		RunnableStep: zbaction.ProcStep{Uses: "action/copy-local-dir", With: zbaction.ProcStepArgs{
+			"src":      src,
+			"dest":     "out",
+			"symlinks": "deep",
+		}},
+	})
+
+	assert.ErrorContains(t, err, "points to its parent directory")
+}
+
+func TestCopyLocalDir_DeepLoop(t *testing.T) {
+	src := t.TempDir()
+	for _, dir := range []string{"a", "b"} {
+		if err := os.Mkdir(filepath.Join(src, dir), 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Symlink("../b", filepath.Join(src, "a", "link")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink("../a", filepath.Join(src, "b", "link")); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err := runCheckout(t, zbaction.Step{
+		RunnableStep: zbaction.ProcStep{Uses: "action/copy-local-dir", With: zbaction.ProcStepArgs{
+			"src":      src,
+			"dest":     "out",
+			"symlinks": "deep",
+		}},
+	})
+
+	assert.ErrorContains(t, err, "forms a loop")
+}
@@ -0,0 +1,414 @@
+package procedures
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	zbaction "github.com/zeabur/action"
+)
+
+func init() {
+	zbaction.RegisterProcedureWithSchema("action/download", &zbaction.ProcedureSchema{
+		Description: "Download a file into the job root, and verify its checksum.",
+		Arguments: []zbaction.ArgumentSchema{
+			{Name: "url", Required: true, Description: "The URL to download."},
+			{Name: "filename", Description: "The path of the file, relative to the job root. By default, it is the last segment of the URL path."},
+			{Name: "headers", Description: "The request headers, one per line, as `<name>: <value>`. Use variables for the secrets, such as `Authorization: Bearer ${TOKEN}`. They are not sent to the other hosts the request is redirected to."},
+			{Name: "checksum", Description: "The expected digest of the file, as `sha256:<hex>` or `sha512:<hex>`. The file is removed if it does not match."},
+			{Name: "retries", Type: zbaction.ArgumentTypeInt, Default: "3", Description: "The number of retries on the network errors and the 429 and 5xx responses."},
+			{Name: "retryDelay", Default: "1s", Description: "The delay before the first retry, which doubles for each retry up to 1 minute."},
+			{Name: "timeout", Default: "10m", Description: "The timeout of each attempt, including downloading the content."},
+		},
+		Outputs: []zbaction.OutputSchema{
+			{Name: "filepath", Description: "The absolute path of the downloaded file."},
+			{Name: "size", Description: "The size of the file in bytes."},
+			{Name: "digest", Description: "The digest of the file, as `<algorithm>:<hex>`. The algorithm is the one of `checksum`, or `sha256` by default."},
+		},
+		Examples: []zbaction.ProcedureExample{
+			{
+				Description: "Download and verify a Go toolchain.",
+				With: zbaction.ProcStepArgs{
+					"url":      "https://go.dev/dl/go1.22.0.linux-amd64.tar.gz",
+					"checksum": "sha256:f6c8a87aa03b92c4b0bf3d558e28ea03006eb29db78917daec5cfb6ec1046265",
+				},
+			},
+			{
+				Description: "Download a file from a private server.",
+				With: zbaction.ProcStepArgs{
+					"url":      "https://artifacts.example.com/toolchain.tar.gz",
+					"filename": "tools/toolchain.tar.gz",
+					"headers":  "Authorization: Bearer ${ARTIFACTS_TOKEN}",
+				},
+			},
+		},
+	}, func(args zbaction.ProcStepArgs) (zbaction.ProcedureStep, error) {
+		if checksum := args["checksum"]; !strings.Contains(checksum, "$") {
+			if _, _, err := parseChecksum(checksum); err != nil {
+				return nil, err
+			}
+		}
+		if retries := args["retries"]; !strings.Contains(retries, "$") {
+			if _, err := parseRetries(retries); err != nil {
+				return nil, err
+			}
+		}
+		for _, key := range []string{"retryDelay", "timeout"} {
+			if d := args[key]; !strings.Contains(d, "$") {
+				if _, err := parseDownloadDuration(key, d); err != nil {
+					return nil, err
+				}
+			}
+		}
+
+		return &DownloadAction{
+			URL:        zbaction.NewArgumentStr(args["url"]),
+			Filename:   zbaction.NewArgumentStr(args["filename"]),
+			Headers:    zbaction.NewArgumentStr(args["headers"]),
+			Checksum:   zbaction.NewArgumentStr(args["checksum"]),
+			Retries:    zbaction.NewArgumentStr(args["retries"]),
+			RetryDelay: zbaction.NewArgumentStr(args["retryDelay"]),
+			Timeout:    zbaction.NewArgumentStr(args["timeout"]),
+		}, nil
+	})
+}
+
+type DownloadAction struct {
+	URL        zbaction.Argument[string]
+	Filename   zbaction.Argument[string]
+	Headers    zbaction.Argument[string]
+	Checksum   zbaction.Argument[string]
+	Retries    zbaction.Argument[string]
+	RetryDelay zbaction.Argument[string]
+	Timeout    zbaction.Argument[string]
+}
+
+// maxRetryDelay is the maximum delay between the retries.
+const maxRetryDelay = time.Minute
+
+// maxRedirects is the maximum number of redirects to follow, like http.DefaultClient.
+const maxRedirects = 10
+
+func (d *DownloadAction) Run(ctx context.Context, sc *zbaction.StepContext) (zbaction.CleanupFn, error) {
+	rawURL := d.URL.Value(sc.ExpandString)
+
+	u, err := url.Parse(rawURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+		return nil, zbaction.NewErrInvalidArgument("url", "not an HTTP URL")
+	}
+
+	algorithm, expected, err := parseChecksum(d.Checksum.Value(sc.ExpandString))
+	if err != nil {
+		return nil, err
+	}
+	retries, err := parseRetries(d.Retries.Value(sc.ExpandString))
+	if err != nil {
+		return nil, err
+	}
+	retryDelay, err := parseDownloadDuration("retryDelay", d.RetryDelay.Value(sc.ExpandString))
+	if err != nil {
+		return nil, err
+	}
+	timeout, err := parseDownloadDuration("timeout", d.Timeout.Value(sc.ExpandString))
+	if err != nil {
+		return nil, err
+	}
+	header, err := parseHeaders(d.Headers.Value(sc.ExpandString))
+	if err != nil {
+		return nil, err
+	}
+	client := newDownloadClient(header)
+
+	filename := d.Filename.Value(sc.ExpandString)
+	if filename == "" {
+		filename = path.Base(u.Path)
+		if filename == "." || filename == "/" {
+			return nil, zbaction.NewErrInvalidArgument("filename", "can't be derived from the URL")
+		}
+	}
+	outFilePath, err := zbaction.ResolvePath(sc.Root(), filename)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(filepath.Dir(outFilePath), 0o755); err != nil {
+		return nil, fmt.Errorf("create parent directories: %w", err)
+	}
+
+	// download into a temporary file, so a failed download
+	// does not leave a partial file.
+	tempFile, err := createDownloadFile(outFilePath)
+	if err != nil {
+		return nil, fmt.Errorf("create temporary file: %w", err)
+	}
+	defer func() {
+		_ = tempFile.Close()
+		_ = os.Remove(tempFile.Name())
+	}()
+
+	var size int64
+	var digest hash.Hash
+
+	for attempt := 0; ; attempt++ {
+		attemptCtx, cancel := context.WithTimeout(ctx, timeout)
+		size, digest, err = d.download(attemptCtx, client, u, header, algorithm, tempFile)
+		cancel()
+		if err == nil {
+			break
+		}
+		if ctx.Err() != nil {
+			return nil, err
+		}
+
+		var retryable retryableError
+		if attempt >= retries || !errors.As(err, &retryable) {
+			return nil, err
+		}
+
+		delay := retryBackoff(retryDelay, attempt)
+		_, _ = fmt.Fprintf(sc.Stderr(), "Retrying in %s: %s\n", delay, err)
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(delay):
+		}
+	}
+
+	actual := hex.EncodeToString(digest.Sum(nil))
+	if expected != "" && actual != expected {
+		return nil, fmt.Errorf("checksum mismatch: expected %s:%s, got %s:%s", algorithm, expected, algorithm, actual)
+	}
+
+	if err := tempFile.Close(); err != nil {
+		return nil, err
+	}
+	if err := os.Rename(tempFile.Name(), outFilePath); err != nil {
+		return nil, fmt.Errorf("move downloaded file: %w", err)
+	}
+
+	sc.SetThisOutput("filepath", outFilePath)
+	sc.SetThisOutput("size", strconv.FormatInt(size, 10))
+	sc.SetThisOutput("digest", algorithm+":"+actual)
+
+	return nil, nil
+}
+
+// download downloads u into f from the beginning, and hashes the content.
+//
+// The errors are retryable unless the response is a client error,
+// and the URL in them is redacted.
+func (d *DownloadAction) download(ctx context.Context, client *http.Client, u *url.URL, header http.Header, algorithm string, f *os.File) (int64, hash.Hash, error) {
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return 0, nil, err
+	}
+	if err := f.Truncate(0); err != nil {
+		return 0, nil, err
+	}
+
+	redacted := redactURL(u)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return 0, nil, fmt.Errorf("download %s: %w", redacted, err)
+	}
+	req.Header = header.Clone()
+
+	resp, err := client.Do(req)
+	if err != nil {
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			urlErr.URL = redacted
+		}
+		return 0, nil, retryableError{err}
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		err := fmt.Errorf("download %s: %s", redacted, resp.Status)
+		if resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500 {
+			return 0, nil, retryableError{err}
+		}
+		return 0, nil, err
+	}
+
+	digest := sha256.New()
+	if algorithm == "sha512" {
+		digest = sha512.New()
+	}
+
+	size, err := io.Copy(io.MultiWriter(f, digest), resp.Body)
+	if err != nil {
+		return 0, nil, retryableError{fmt.Errorf("download %s: %w", redacted, err)}
+	}
+
+	return size, digest, nil
+}
+
+// newDownloadClient creates a client which drops the custom headers
+// when redirected to another host, as they may contain the credentials.
+//
+// The client only drops the well-known sensitive headers,
+// such as Authorization and Cookie, by itself.
+func newDownloadClient(header http.Header) *http.Client {
+	return &http.Client{
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) >= maxRedirects {
+				return fmt.Errorf("stopped after %d redirects", maxRedirects)
+			}
+
+			if req.URL.Host != via[0].URL.Host {
+				for key := range header {
+					req.Header.Del(key)
+				}
+			}
+
+			return nil
+		},
+	}
+}
+
+// createDownloadFile creates a temporary file next to path, with
+// the permission 0644 minus the umask like the other created files.
+func createDownloadFile(path string) (*os.File, error) {
+	for {
+		suffix := make([]byte, 8)
+		if _, err := rand.Read(suffix); err != nil {
+			return nil, err
+		}
+
+		name := filepath.Join(filepath.Dir(path), "."+filepath.Base(path)+"."+hex.EncodeToString(suffix))
+		f, err := os.OpenFile(name, os.O_RDWR|os.O_CREATE|os.O_EXCL, 0o644)
+		if errors.Is(err, fs.ErrExist) {
+			continue
+		}
+		return f, err
+	}
+}
+
+// redactURL formats u without the user info and the query,
+// which may contain the credentials.
+func redactURL(u *url.URL) string {
+	redacted := *u
+	redacted.User = nil
+	redacted.RawQuery = ""
+	redacted.ForceQuery = false
+	redacted.Fragment = ""
+
+	s := redacted.String()
+	if u.RawQuery != "" {
+		s += "?REDACTED"
+	}
+
+	return s
+}
+
+// retryBackoff gets the delay before the retry after attempt,
+// which doubles the base delay for each attempt up to maxRetryDelay.
+func retryBackoff(base time.Duration, attempt int) time.Duration {
+	delay := base
+	for i := 0; i < attempt && delay < maxRetryDelay; i++ {
+		delay *= 2
+	}
+
+	return min(delay, maxRetryDelay)
+}
+
+// retryableError is an error of a download which may succeed if retried.
+type retryableError struct {
+	err error
+}
+
+func (e retryableError) Error() string {
+	return e.err.Error()
+}
+
+func (e retryableError) Unwrap() error {
+	return e.err
+}
+
+// parseChecksum parses `<algorithm>:<hex>`. An empty checksum means sha256
+// without the verification.
+func parseChecksum(s string) (algorithm string, digest string, err error) {
+	if s == "" {
+		return "sha256", "", nil
+	}
+
+	algorithm, digest, ok := strings.Cut(strings.TrimSpace(s), ":")
+	digest = strings.ToLower(digest)
+
+	var length int
+	switch algorithm {
+	case "sha256":
+		length = sha256.Size
+	case "sha512":
+		length = sha512.Size
+	default:
+		ok = false
+	}
+	if !ok {
+		return "", "", zbaction.NewErrInvalidArgument("checksum", "expected sha256:<hex> or sha512:<hex>")
+	}
+
+	if decoded, err := hex.DecodeString(digest); err != nil || len(decoded) != length {
+		return "", "", zbaction.NewErrInvalidArgument("checksum", "invalid "+algorithm+" digest: "+digest)
+	}
+
+	return algorithm, digest, nil
+}
+
+func parseRetries(s string) (int, error) {
+	retries, err := strconv.Atoi(s)
+	if err != nil || retries < 0 {
+		return 0, zbaction.NewErrInvalidArgument("retries", "not a non-negative integer: "+s)
+	}
+
+	return retries, nil
+}
+
+func parseDownloadDuration(key string, s string) (time.Duration, error) {
+	d, err := time.ParseDuration(s)
+	if err != nil || d < 0 || (key == "timeout" && d == 0) {
+		return 0, zbaction.NewErrInvalidArgument(key, "not a duration: "+s)
+	}
+
+	return d, nil
+}
+
+// parseHeaders parses the headers in the format of `<name>: <value>`, one per line.
+func parseHeaders(s string) (http.Header, error) {
+	header := make(http.Header)
+
+	for _, line := range strings.Split(s, "\n") {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+
+		name, value, ok := strings.Cut(line, ":")
+		name = strings.TrimSpace(name)
+		if !ok || name == "" {
+			// the line may contain a secret, so it is not included
+			return nil, zbaction.NewErrInvalidArgument("headers", "expected <name>: <value>")
+		}
+
+		header.Add(name, strings.TrimSpace(value))
+	}
+
+	return header, nil
+}
+
+var _ zbaction.ProcedureStep = (*DownloadAction)(nil)
@@ -0,0 +1,273 @@
+package procedures_test
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"syscall"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	zbaction "github.com/zeabur/action"
+)
+
+const downloadContent = "toolchain"
+
+// newDownloadServer serves downloadContent after failing with failStatus for failures times.
+func newDownloadServer(t *testing.T, failures int32, failStatus int) (*httptest.Server, *atomic.Int32) {
+	hits := &atomic.Int32{}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if hits.Add(1) <= failures {
+			w.WriteHeader(failStatus)
+			return
+		}
+		if r.Header.Get("Authorization") != "Bearer secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		_, _ = w.Write([]byte(downloadContent))
+	}))
+	t.Cleanup(server.Close)
+
+	return server, hits
+}
+
+func runDownload(t *testing.T, with zbaction.ProcStepArgs) (string, error) {
+	stdout := &bytes.Buffer{}
+
+	with["headers"] = "Authorization: Bearer ${TOKEN}\nX-Empty:"
+	with["retryDelay"] = "1ms"
+
+	err := zbaction.RunAction(context.Background(), zbaction.Action{
+		Variables: map[string]string{"TOKEN": "secret"},
+		Jobs: []zbaction.Job{
+			{
+				Steps: []zbaction.Step{
+					{
+						ID:           "download",
+						RunnableStep: zbaction.ProcStep{Uses: "action/download", With: with},
+					},
+					{
+						RunnableStep: zbaction.CommandStep{
+							Command: []string{"sh", "-c", `echo "${out.download.size}|${out.download.digest}" && cat "${out.download.filepath}"`},
+						},
+					},
+				},
+			},
+		},
+	}, zbaction.WithCustomStdout(stdout))
+
+	return stdout.String(), err
+}
+
+func TestDownload(t *testing.T) {
+	server, hits := newDownloadServer(t, 2, http.StatusServiceUnavailable)
+
+	sha256sum := sha256.Sum256([]byte(downloadContent))
+	stdout, err := runDownload(t, zbaction.ProcStepArgs{
+		"url":      server.URL + "/dl/toolchain.tar.gz",
+		"checksum": "sha256:" + hex.EncodeToString(sha256sum[:]),
+	})
+
+	assert.NoError(t, err)
+	assert.Equal(t, "9|sha256:"+hex.EncodeToString(sha256sum[:])+"\n"+downloadContent, stdout)
+	assert.Equal(t, int32(3), hits.Load())
+}
+
+func TestDownload_SHA512(t *testing.T) {
+	server, _ := newDownloadServer(t, 0, 0)
+
+	sha512sum := sha512.Sum512([]byte(downloadContent))
+	stdout, err := runDownload(t, zbaction.ProcStepArgs{
+		"url":      server.URL + "/dl/toolchain.tar.gz",
+		"filename": "tools/go.tar.gz",
+		"checksum": "sha512:" + hex.EncodeToString(sha512sum[:]),
+	})
+
+	assert.NoError(t, err)
+	assert.Equal(t, "9|sha512:"+hex.EncodeToString(sha512sum[:])+"\n"+downloadContent, stdout)
+}
+
+func TestDownload_ChecksumMismatch(t *testing.T) {
+	server, _ := newDownloadServer(t, 0, 0)
+
+	_, err := runDownload(t, zbaction.ProcStepArgs{
+		"url":      server.URL + "/toolchain.tar.gz",
+		"checksum": "sha256:" + hex.EncodeToString(make([]byte, sha256.Size)),
+	})
+
+	assert.ErrorContains(t, err, "checksum mismatch")
+}
+
+func TestDownload_Retries(t *testing.T) {
+	testcases := []struct {
+		name         string
+		failStatus   int
+		retries      string
+		expectedHits int32
+	}{
+		{"exhausted", http.StatusInternalServerError, "1", 2},
+		{"not retried", http.StatusNotFound, "3", 1},
+		{"no retries", http.StatusTooManyRequests, "0", 1},
+	}
+
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			server, hits := newDownloadServer(t, 10, tc.failStatus)
+
+			_, err := runDownload(t, zbaction.ProcStepArgs{
+				"url":     server.URL + "/toolchain.tar.gz",
+				"retries": tc.retries,
+			})
+
+			assert.ErrorContains(t, err, http.StatusText(tc.failStatus))
+			assert.Equal(t, tc.expectedHits, hits.Load())
+		})
+	}
+}
+
+func TestDownload_FileMode(t *testing.T) {
+	oldUmask := syscall.Umask(0o022)
+	defer syscall.Umask(oldUmask)
+
+	server, _ := newDownloadServer(t, 0, 0)
+
+	stdout, err := runCheckout(t,
+		zbaction.Step{
+			RunnableStep: zbaction.ProcStep{Uses: "action/download", With: zbaction.ProcStepArgs{
+				"url":     server.URL + "/toolchain.tar.gz",
+				"headers": "Authorization: Bearer secret",
+			}},
+		},
+		zbaction.Step{
+			RunnableStep: zbaction.CommandStep{Command: []string{"stat", "-c", "%a", "toolchain.tar.gz"}},
+		},
+	)
+
+	assert.NoError(t, err)
+	assert.Equal(t, "644\n", stdout)
+}
+
+func TestDownload_Timeout(t *testing.T) {
+	hits := &atomic.Int32{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if hits.Add(1) == 1 {
+			// stall the first attempt until it times out
+			<-r.Context().Done()
+			return
+		}
+
+		_, _ = w.Write([]byte(downloadContent))
+	}))
+	t.Cleanup(server.Close)
+
+	stdout, err := runDownload(t, zbaction.ProcStepArgs{
+		"url":     server.URL + "/toolchain.tar.gz",
+		"timeout": "100ms",
+	})
+
+	assert.NoError(t, err)
+	assert.True(t, strings.HasSuffix(stdout, "\n"+downloadContent), stdout)
+	assert.Equal(t, int32(2), hits.Load())
+}
+
+func TestDownload_RedactURL(t *testing.T) {
+	server, _ := newDownloadServer(t, 10, http.StatusNotFound)
+
+	closedServer := httptest.NewServer(http.NotFoundHandler())
+	closedServer.Close()
+
+	for _, serverURL := range []string{server.URL, closedServer.URL} {
+		rawURL := strings.Replace(serverURL, "http://", "http://user:p%40ss@", 1) + "/toolchain.tar.gz?token=qu3ry#fragment"
+
+		_, err := runDownload(t, zbaction.ProcStepArgs{
+			"url":     rawURL,
+			"retries": "0",
+		})
+
+		if assert.Error(t, err) {
+			assert.Contains(t, err.Error(), serverURL+"/toolchain.tar.gz?REDACTED")
+			assert.NotContains(t, err.Error(), "user")
+			assert.NotContains(t, err.Error(), "qu3ry")
+		}
+	}
+}
+
+func TestDownload_InvalidArguments(t *testing.T) {
+	for _, with := range []zbaction.ProcStepArgs{
+		{"url": "file:///etc/passwd"},
+		{"url": "https://example.com/"},
+		{"url": "https://example.com/a", "filename": "../a"},
+		{"url": "https://example.com/a", "checksum": "md5:d41d8cd98f00b204e9800998ecf8427e"},
+		{"url": "https://example.com/a", "checksum": "sha256:1234"},
+		{"url": "https://example.com/a", "retries": "-1"},
+		{"url": "https://example.com/a", "retryDelay": "soon"},
+		{"url": "https://example.com/a", "timeout": "0s"},
+		{"url": "https://example.com/a", "timeout": "-1m"},
+		{"url": "https://example.com/a", "headers": "Bearer ${TOKEN}"},
+	} {
+		_, err := runCheckout(t, zbaction.Step{
+			RunnableStep: zbaction.ProcStep{Uses: "action/download", With: with},
+		})
+
+		assert.Error(t, err, with)
+	}
+}
+
+func TestDownload_RedirectHeaders(t *testing.T) {
+	var received atomic.Value
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received.Store(r.Header.Get("X-Api-Token"))
+		_, _ = w.Write([]byte(downloadContent))
+	}))
+	t.Cleanup(target.Close)
+
+	origin := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/moved" {
+			// redirected within the same host, the headers are kept
+			if r.Header.Get("X-Api-Token") != "secret" {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			http.Redirect(w, r, target.URL+"/toolchain.tar.gz", http.StatusFound)
+			return
+		}
+		http.Redirect(w, r, "/moved", http.StatusFound)
+	}))
+	t.Cleanup(origin.Close)
+
+	stdout := &bytes.Buffer{}
+	err := zbaction.RunAction(context.Background(), zbaction.Action{
+		Variables: map[string]string{"TOKEN": "secret"},
+		Jobs: []zbaction.Job{
+			{
+				Steps: []zbaction.Step{
+					{
+						ID: "download",
+						RunnableStep: zbaction.ProcStep{Uses: "action/download", With: zbaction.ProcStepArgs{
+							"url":     origin.URL + "/toolchain.tar.gz",
+							"headers": "X-Api-Token: ${TOKEN}",
+						}},
+					},
+					{
+						RunnableStep: zbaction.CommandStep{
+							Command: []string{"cat", "${out.download.filepath}"},
+						},
+					},
+				},
+			},
+		},
+	}, zbaction.WithCustomStdout(stdout))
+
+	assert.NoError(t, err)
+	assert.Equal(t, downloadContent, stdout.String())
+	assert.Equal(t, "", received.Load())
+}
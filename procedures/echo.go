@@ -3,25 +3,102 @@ package procedures
 import (
 	"context"
 	"fmt"
+	"strconv"
+	"strings"
 
 	zbaction "github.com/zeabur/action"
 )
 
 func init() {
-	zbaction.RegisterProcedure("action/echo", func(args zbaction.ProcStepArgs) (zbaction.ProcedureStep, error) {
+	zbaction.RegisterProcedureWithSchema("action/echo", &zbaction.ProcedureSchema{
+		Description: "Print a message.",
+		Arguments: []zbaction.ArgumentSchema{
+			{Name: "message", Description: "The message to print."},
+			{Name: "level", Enum: []string{string(zbaction.AnnotationLevelNotice), string(zbaction.AnnotationLevelWarning), string(zbaction.AnnotationLevelError)}, Description: "The level of the annotation to raise with the message. By default, the message is only printed."},
+			{Name: "file", Description: "The file the annotation refers to, relative to the job root."},
+			{Name: "line", Type: zbaction.ArgumentTypeInt, Description: "The line in `file` the annotation refers to."},
+		},
+		Examples: []zbaction.ProcedureExample{
+			{
+				With: zbaction.ProcStepArgs{
+					"message": "Hello, ${name}!",
+				},
+			},
+			{
+				Description: "Warn about a deprecated option in a configuration file.",
+				With: zbaction.ProcStepArgs{
+					"message": "`buildCommand` is deprecated. Use `build.command` instead.",
+					"level":   "warning",
+					"file":    "zbpack.json",
+					"line":    "3",
+				},
+			},
+		},
+	}, func(args zbaction.ProcStepArgs) (zbaction.ProcedureStep, error) {
+		if line := args["line"]; !strings.Contains(line, "$") {
+			if _, err := parseAnnotationLine(line); err != nil {
+				return nil, err
+			}
+		}
+
 		return &EchoAction{
 			Message: zbaction.NewArgumentStr(args["message"]),
+			Level:   zbaction.NewArgumentStr(args["level"]),
+			File:    zbaction.NewArgumentStr(args["file"]),
+			Line:    zbaction.NewArgumentStr(args["line"]),
 		}, nil
 	})
 }
 
 type EchoAction struct {
 	Message zbaction.Argument[string]
+	Level   zbaction.Argument[string]
+	File    zbaction.Argument[string]
+	Line    zbaction.Argument[string]
 }
 
 func (i *EchoAction) Run(_ context.Context, sc *zbaction.StepContext) (zbaction.CleanupFn, error) {
-	fmt.Println(i.Message.Value(sc.ExpandString))
+	message := i.Message.Value(sc.ExpandString)
+
+	if _, err := fmt.Fprintln(sc.Stdout(), message); err != nil {
+		return nil, err
+	}
+
+	level := zbaction.AnnotationLevel(i.Level.Value(sc.ExpandString))
+	switch level {
+	case "":
+		return nil, nil
+	case zbaction.AnnotationLevelNotice, zbaction.AnnotationLevelWarning, zbaction.AnnotationLevelError:
+	default:
+		return nil, zbaction.NewErrInvalidArgument("level", "unknown level: "+string(level))
+	}
+
+	line, err := parseAnnotationLine(i.Line.Value(sc.ExpandString))
+	if err != nil {
+		return nil, err
+	}
+
+	sc.Annotate(zbaction.Annotation{
+		Level:   level,
+		Message: message,
+		File:    i.File.Value(sc.ExpandString),
+		Line:    line,
+	})
+
 	return nil, nil
 }
 
+func parseAnnotationLine(s string) (int, error) {
+	if s == "" {
+		return 0, nil
+	}
+
+	line, err := strconv.Atoi(s)
+	if err != nil || line < 0 {
+		return 0, zbaction.NewErrInvalidArgument("line", "not a line number: "+s)
+	}
+
+	return line, nil
+}
+
 var _ zbaction.ProcedureStep = (*EchoAction)(nil)
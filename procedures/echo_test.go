@@ -0,0 +1,56 @@
+package procedures_test
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	zbaction "github.com/zeabur/action"
+)
+
+func TestEcho(t *testing.T) {
+	stdout := &bytes.Buffer{}
+
+	result, err := zbaction.RunActionWithResult(context.Background(), zbaction.Action{
+		Variables: map[string]string{"name": "world"},
+		Jobs: []zbaction.Job{
+			{
+				Steps: []zbaction.Step{
+					{
+						RunnableStep: zbaction.ProcStep{Uses: "action/echo", With: zbaction.ProcStepArgs{
+							"message": "Hello, ${name}!",
+						}},
+					},
+					{
+						RunnableStep: zbaction.ProcStep{Uses: "action/echo", With: zbaction.ProcStepArgs{
+							"message": "deprecated option",
+							"level":   "warning",
+							"file":    "zbpack.json",
+							"line":    "3",
+						}},
+					},
+				},
+			},
+		},
+	}, zbaction.WithCustomStdout(stdout))
+
+	assert.NoError(t, err)
+	assert.Equal(t, "Hello, world!\ndeprecated option\n", stdout.String())
+	assert.Equal(t, []zbaction.Annotation{
+		{Level: zbaction.AnnotationLevelWarning, Message: "deprecated option", File: "zbpack.json", Line: 3},
+	}, result.Annotations())
+}
+
+func TestEcho_InvalidArguments(t *testing.T) {
+	for _, with := range []zbaction.ProcStepArgs{
+		{"message": "a", "level": "debug"},
+		{"message": "a", "level": "notice", "line": "-1"},
+	} {
+		_, err := runCheckout(t, zbaction.Step{
+			RunnableStep: zbaction.ProcStep{Uses: "action/echo", With: with},
+		})
+
+		assert.Error(t, err, with)
+	}
+}
@@ -0,0 +1,334 @@
+package procedures
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/Masterminds/semver/v3"
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	zbaction "github.com/zeabur/action"
+)
+
+func init() {
+	zbaction.RegisterProcedureWithSchema("action/git-version", &zbaction.ProcedureSchema{
+		Description: "Compute the version of the checked out commit from the nearest semantic version tag. " +
+			"The commit distance to the tag is added to the patch version, such as `1.2.0` + 3 commits = `1.2.3`, " +
+			"and the version of the other branches than the default branch has the branch name as the pre-release, such as `1.2.3-feature-x`. " +
+			"The history and the tags must be in the repository, so check it out with `depth: 0` and `tags: true`.",
+		Arguments: []zbaction.ArgumentSchema{
+			{Name: "path", Description: "The directory of the repository, relative to the job root. By default, it is the job root."},
+			{Name: "branch", Description: "The branch being built, such as `main` or `${out.checkout.ref}`. By default, it is the branch HEAD refers to. " +
+				"If it is unknown, `HEAD`, or a ref other than `refs/heads/*` such as a tag, the commit is considered on the default branch."},
+			{Name: "defaultBranch", Default: "main", Description: "The default branch, whose versions have no pre-release."},
+			{Name: "tagPrefix", Description: "The prefix of the tags to consider, such as `api/` in a monorepo. The prefix is removed before parsing the version."},
+		},
+		Outputs: []zbaction.OutputSchema{
+			{Name: "version", Description: "The semantic version, such as `1.2.3` or `1.2.3-feature-x`. It is also valid as an image tag."},
+			{Name: "tag", Description: "The nearest tag. Empty if there is no tag, where the version is based on `0.0.0`."},
+			{Name: "distance", Description: "The number of commits since the nearest tag."},
+			{Name: "describe", Description: "The `git describe --tags` style description, such as `v1.2.0-3-gabcdef0`."},
+			{Name: "sha", Description: "The SHA of the commit."},
+			{Name: "sourceDateEpoch", Description: "The commit time in Unix seconds, for `SOURCE_DATE_EPOCH`."},
+		},
+		Examples: []zbaction.ProcedureExample{
+			{
+				Description: "Compute the version of the checked out branch.",
+				With: zbaction.ProcStepArgs{
+					"branch": "${out.checkout.ref}",
+				},
+			},
+		},
+	}, func(args zbaction.ProcStepArgs) (zbaction.ProcedureStep, error) {
+		return &GitVersionAction{
+			Path:          zbaction.NewArgumentStr(args["path"]),
+			Branch:        zbaction.NewArgumentStr(args["branch"]),
+			DefaultBranch: zbaction.NewArgumentStr(args["defaultBranch"]),
+			TagPrefix:     zbaction.NewArgumentStr(args["tagPrefix"]),
+		}, nil
+	})
+}
+
+type GitVersionAction struct {
+	Path          zbaction.Argument[string]
+	Branch        zbaction.Argument[string]
+	DefaultBranch zbaction.Argument[string]
+	TagPrefix     zbaction.Argument[string]
+}
+
+func (i *GitVersionAction) Run(ctx context.Context, sc *zbaction.StepContext) (zbaction.CleanupFn, error) {
+	repositoryPath, err := zbaction.ResolvePath(sc.Root(), i.Path.Value(sc.ExpandString))
+	if err != nil {
+		return nil, fmt.Errorf("resolve path: %w", err)
+	}
+
+	repository, err := git.PlainOpen(repositoryPath)
+	if err != nil {
+		return nil, fmt.Errorf("open repository: %w", err)
+	}
+
+	head, err := repository.Head()
+	if err != nil {
+		return nil, fmt.Errorf("get HEAD: %w", err)
+	}
+	commit, err := repository.CommitObject(head.Hash())
+	if err != nil {
+		return nil, fmt.Errorf("get commit %s: %w", head.Hash(), err)
+	}
+
+	branch := i.Branch.Value(sc.ExpandString)
+	if branch == "" && head.Name().IsBranch() {
+		branch = head.Name().Short()
+	}
+
+	tags, err := semverTags(repository, i.TagPrefix.Value(sc.ExpandString))
+	if err != nil {
+		return nil, err
+	}
+
+	tag, distance, err := describeCommit(ctx, repository, commit, tags)
+	if err != nil {
+		return nil, err
+	}
+
+	version := semver.MustParse("0.0.0")
+	if tag != nil {
+		version = tag.version
+	}
+	version, err = versionAfter(version, distance, branch, i.DefaultBranch.Value(sc.ExpandString))
+	if err != nil {
+		return nil, err
+	}
+
+	shortSha := commit.Hash.String()[:7]
+	describe := "g" + shortSha
+	tagName := ""
+	if tag != nil {
+		tagName = tag.name
+		describe = tag.name
+		if distance > 0 {
+			describe += "-" + strconv.Itoa(distance) + "-g" + shortSha
+		}
+	}
+
+	sc.SetThisOutput("version", version.String())
+	sc.SetThisOutput("tag", tagName)
+	sc.SetThisOutput("distance", strconv.Itoa(distance))
+	sc.SetThisOutput("describe", describe)
+	sc.SetThisOutput("sha", commit.Hash.String())
+	sc.SetThisOutput("sourceDateEpoch", strconv.FormatInt(commit.Committer.When.Unix(), 10))
+
+	return nil, nil
+}
+
+type semverTag struct {
+	name    string
+	version *semver.Version
+}
+
+// semverTags gets the tags of semantic versions with the prefix,
+// keyed by the commits they point to. If a commit has several tags,
+// the highest version is kept.
+func semverTags(repository *git.Repository, prefix string) (map[plumbing.Hash]semverTag, error) {
+	refs, err := repository.Tags()
+	if err != nil {
+		return nil, fmt.Errorf("list tags: %w", err)
+	}
+
+	tags := make(map[plumbing.Hash]semverTag)
+	err = refs.ForEach(func(ref *plumbing.Reference) error {
+		name := ref.Name().Short()
+
+		versionString, ok := strings.CutPrefix(name, prefix)
+		if !ok {
+			return nil
+		}
+		version, err := semver.NewVersion(versionString)
+		if err != nil {
+			return nil
+		}
+
+		// peel the annotated tags
+		hash := ref.Hash()
+		if tag, err := repository.TagObject(hash); err == nil {
+			c, err := tag.Commit()
+			if err != nil {
+				return nil
+			}
+			hash = c.Hash
+		}
+
+		if existing, ok := tags[hash]; !ok || version.GreaterThan(existing.version) {
+			tags[hash] = semverTag{name: name, version: version}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("list tags: %w", err)
+	}
+
+	return tags, nil
+}
+
+// describeCommit finds the nearest tag of commit like `git describe`,
+// and counts the commits reachable from commit but not from the tag.
+//
+// The tag is nil if no tag is reachable, and then all the reachable commits
+// are counted. The commits missing in a shallow repository are ignored.
+func describeCommit(ctx context.Context, repository *git.Repository, commit *object.Commit, tags map[plumbing.Hash]semverTag) (*semverTag, int, error) {
+	var tag *semverTag
+	var tagHash plumbing.Hash
+
+	_, err := walkAncestors(ctx, repository, commit.Hash, func(hash plumbing.Hash) bool {
+		if tag != nil {
+			return false
+		}
+		if t, ok := tags[hash]; ok {
+			tag, tagHash = &t, hash
+			return false
+		}
+		return true
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+
+	var tagAncestors map[plumbing.Hash]struct{}
+	if tag != nil {
+		tagAncestors, err = walkAncestors(ctx, repository, tagHash, nil)
+		if err != nil {
+			return nil, 0, err
+		}
+	}
+
+	distance := 0
+	_, err = walkAncestors(ctx, repository, commit.Hash, func(hash plumbing.Hash) bool {
+		if _, ok := tagAncestors[hash]; ok {
+			return false
+		}
+		distance++
+		return true
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return tag, distance, nil
+}
+
+// walkAncestors visits the commit and its ancestors in breadth-first order,
+// and returns the visited commits. The parents of a commit are not visited
+// if visit returns false. A nil visit visits all the ancestors.
+func walkAncestors(ctx context.Context, repository *git.Repository, from plumbing.Hash, visit func(hash plumbing.Hash) bool) (map[plumbing.Hash]struct{}, error) {
+	visited := map[plumbing.Hash]struct{}{from: {}}
+	queue := []plumbing.Hash{from}
+
+	for len(queue) > 0 {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		hash := queue[0]
+		queue = queue[1:]
+
+		if visit != nil && !visit(hash) {
+			continue
+		}
+
+		commit, err := repository.CommitObject(hash)
+		if errors.Is(err, plumbing.ErrObjectNotFound) {
+			// beyond the history of a shallow repository
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("get commit %s: %w", hash, err)
+		}
+
+		for _, parent := range commit.ParentHashes {
+			if _, ok := visited[parent]; !ok {
+				visited[parent] = struct{}{}
+				queue = append(queue, parent)
+			}
+		}
+	}
+
+	return visited, nil
+}
+
+// versionAfter computes the version of the commit distance commits after the version.
+//
+// The distance is added to the patch version, or appended to the pre-release
+// if the version is a pre-release. On the other branches than defaultBranch,
+// the branch name is appended to the pre-release.
+func versionAfter(version *semver.Version, distance int, branch string, defaultBranch string) (*semver.Version, error) {
+	prerelease := version.Prerelease()
+	patch := version.Patch()
+
+	if distance > 0 {
+		if prerelease == "" {
+			patch += uint64(distance)
+		} else {
+			prerelease += "." + strconv.Itoa(distance)
+		}
+	}
+
+	branch = branchName(branch)
+	if branch != "" && branch != defaultBranch {
+		prerelease = strings.TrimPrefix(prerelease+"."+prereleaseIdentifier(branch), ".")
+	}
+
+	v := fmt.Sprintf("%d.%d.%d", version.Major(), version.Minor(), patch)
+	if prerelease != "" {
+		v += "-" + prerelease
+	}
+
+	parsed, err := semver.StrictNewVersion(v)
+	if err != nil {
+		return nil, fmt.Errorf("compute version %s: %w", v, err)
+	}
+	return parsed, nil
+}
+
+// branchName gets the name of branch, which can be a short or full ref name.
+// It is empty if branch is HEAD or a ref other than a branch, such as a tag.
+func branchName(branch string) string {
+	switch {
+	case branch == "HEAD":
+		return ""
+	case strings.HasPrefix(branch, "refs/heads/"):
+		return strings.TrimPrefix(branch, "refs/heads/")
+	case strings.HasPrefix(branch, "refs/"):
+		return ""
+	default:
+		return branch
+	}
+}
+
+// prereleaseIdentifier converts a branch name into a pre-release identifier,
+// which only contains lowercase alphanumerics and hyphens, such as `feature-x`.
+func prereleaseIdentifier(branch string) string {
+	identifier := strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= '0' && r <= '9':
+			return r
+		case r >= 'A' && r <= 'Z':
+			return r - 'A' + 'a'
+		default:
+			return '-'
+		}
+	}, branch)
+	identifier = strings.Trim(identifier, "-")
+
+	// numeric identifiers must not have leading zeros
+	if strings.Trim(identifier, "0123456789") == "" {
+		identifier = "branch-" + identifier
+	}
+
+	return strings.TrimSuffix(identifier, "-")
+}
+
+var _ zbaction.ProcedureStep = (*GitVersionAction)(nil)
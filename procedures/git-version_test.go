@@ -0,0 +1,120 @@
+package procedures_test
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	zbaction "github.com/zeabur/action"
+)
+
+func TestGitVersion(t *testing.T) {
+	repository := newTestRepository(t)
+
+	testcases := []struct {
+		name     string
+		checkout zbaction.ProcStepArgs
+		with     zbaction.ProcStepArgs
+		expected string
+	}{
+		{
+			"tag",
+			zbaction.ProcStepArgs{"ref": "v1.0.0"},
+			zbaction.ProcStepArgs{},
+			"1.0.0|v1.0.0|0|v1.0.0",
+		},
+		{
+			"tag ref",
+			zbaction.ProcStepArgs{"ref": "v1.0.0"},
+			zbaction.ProcStepArgs{"branch": "${out.checkout.ref}"},
+			"1.0.0|v1.0.0|0|v1.0.0",
+		},
+		{
+			"default checkout",
+			zbaction.ProcStepArgs{},
+			zbaction.ProcStepArgs{"branch": "${out.checkout.ref}"},
+			"1.0.2|v1.0.0|2|v1.0.0-2-g" + repository.Main.String()[:7],
+		},
+		{
+			"detached",
+			zbaction.ProcStepArgs{"ref": "refs/pull/1/head"},
+			zbaction.ProcStepArgs{"branch": "HEAD"},
+			"1.0.1|v1.0.0|1|v1.0.0-1-g" + repository.Pull.String()[:7],
+		},
+		{
+			"default branch",
+			zbaction.ProcStepArgs{"ref": "main"},
+			zbaction.ProcStepArgs{"branch": "${out.checkout.ref}"},
+			"1.0.2|v1.0.0|2|v1.0.0-2-g" + repository.Main.String()[:7],
+		},
+		{
+			"other branch",
+			zbaction.ProcStepArgs{"ref": "refs/pull/1/head"},
+			zbaction.ProcStepArgs{"branch": "Feature/X_1"},
+			"1.0.1-feature-x-1|v1.0.0|1|v1.0.0-1-g" + repository.Pull.String()[:7],
+		},
+		{
+			"no tag",
+			zbaction.ProcStepArgs{"ref": "main"},
+			zbaction.ProcStepArgs{"tagPrefix": "api/"},
+			"0.0.3||3|g" + repository.Main.String()[:7],
+		},
+	}
+
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			tc.checkout["url"] = repository.URL
+			tc.checkout["depth"] = "0"
+			tc.checkout["tags"] = "true"
+			stdout := &bytes.Buffer{}
+
+			err := zbaction.RunAction(context.Background(), zbaction.Action{
+				Jobs: []zbaction.Job{
+					{
+						Steps: []zbaction.Step{
+							{
+								ID:           "checkout",
+								RunnableStep: zbaction.ProcStep{Uses: "action/checkout", With: tc.checkout},
+							},
+							{
+								ID:           "version",
+								RunnableStep: zbaction.ProcStep{Uses: "action/git-version", With: tc.with},
+							},
+							{
+								RunnableStep: zbaction.CommandStep{
+									Command: []string{"echo", "${out.version.version}|${out.version.tag}|${out.version.distance}|${out.version.describe}"},
+								},
+							},
+						},
+					},
+				},
+			}, zbaction.WithCustomStdout(stdout))
+
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expected+"\n", stdout.String())
+		})
+	}
+}
+
+func TestGitVersion_SourceDateEpoch(t *testing.T) {
+	repository := newTestRepository(t)
+
+	stdout, err := runCheckout(t,
+		zbaction.Step{
+			RunnableStep: zbaction.ProcStep{Uses: "action/checkout", With: zbaction.ProcStepArgs{"url": repository.URL}},
+		},
+		zbaction.Step{
+			ID:           "version",
+			RunnableStep: zbaction.ProcStep{Uses: "action/git-version"},
+		},
+		zbaction.Step{
+			RunnableStep: zbaction.CommandStep{
+				Command: []string{"echo", "${out.version.sha}|${out.version.sourceDateEpoch}"},
+			},
+		},
+	)
+
+	assert.NoError(t, err)
+	assert.Equal(t, repository.Main.String()+"|1704164645\n", stdout)
+}
@@ -0,0 +1,8 @@
+//go:build !unix
+
+package procedures
+
+// lockFile does not lock across processes on this platform.
+func lockFile(string) (unlock func(), err error) {
+	return func() {}, nil
+}
@@ -0,0 +1,14 @@
+package procvariables
+
+import zbaction "github.com/zeabur/action"
+
+// VarCheckoutCacheDirectoryKey is the key of the variable for the directory
+// where action/checkout keeps the mirrors of the repositories.
+//
+// It should be set as a runtime variable in RunAction.
+const VarCheckoutCacheDirectoryKey = "checkout.opts.cache-directory"
+
+// WithCheckoutCacheDirectory enables the mirror cache of action/checkout in dir.
+func WithCheckoutCacheDirectory(dir string) zbaction.ExecutorOptionsFn {
+	return WithProcVariables(VarCheckoutCacheDirectoryKey, dir)
+}
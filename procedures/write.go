@@ -2,41 +2,246 @@ package procedures
 
 import (
 	"context"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
 	"os"
-	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"text/template"
 
 	zbaction "github.com/zeabur/action"
 )
 
+// WriteEncoding is the encoding of the content of action/write.
+type WriteEncoding string
+
+const (
+	WriteEncodingText   WriteEncoding = "text"
+	WriteEncodingBase64 WriteEncoding = "base64"
+	WriteEncodingHex    WriteEncoding = "hex"
+)
+
 func init() {
-	zbaction.RegisterProcedure("action/write", func(args zbaction.ProcStepArgs) (zbaction.ProcedureStep, error) {
-		filename := args["filename"]
-		if filename == "" {
-			return nil, zbaction.NewErrRequiredArgument("filename")
+	zbaction.RegisterProcedureWithSchema("action/write", &zbaction.ProcedureSchema{
+		Description: "Write a file into the job root. The file is removed when the job cleans up unless `keep` is true.",
+		Arguments: []zbaction.ArgumentSchema{
+			{Name: "filename", Required: true, Description: "The path of the file, relative to the job root."},
+			{Name: "content", Description: "The content of the file."},
+			{Name: "mode", Default: "0644", Description: "The permission of the file in octal, such as `0755`. It is only applied to a new file, regardless of the umask."},
+			{Name: "createParents", Type: zbaction.ArgumentTypeBool, Default: "false", Description: "Create the parent directories if they do not exist."},
+			{Name: "append", Type: zbaction.ArgumentTypeBool, Default: "false", Description: "Append the content to the file instead of overwriting it. The appended content is removed when the job cleans up unless `keep` is true."},
+			{Name: "encoding", Default: string(WriteEncodingText), Enum: []string{string(WriteEncodingText), string(WriteEncodingBase64), string(WriteEncodingHex)}, Description: "The encoding of `content`, which is decoded before writing."},
+			{Name: "template", Type: zbaction.ArgumentTypeBool, Default: "false", Description: "Render `content` as a Go `text/template` instead of expanding the variables in it. " +
+				"`{{ variable \"name\" }}` gets a variable, and `{{ output \"step_id\" \"key\" }}` gets an output of a step."},
+			{Name: "keep", Type: zbaction.ArgumentTypeBool, Default: "false", Description: "Keep the file instead of removing it when the job cleans up, such as for the artifact steps."},
+		},
+		Outputs: []zbaction.OutputSchema{
+			{Name: "filepath", Description: "The absolute path of the written file."},
+		},
+		Examples: []zbaction.ProcedureExample{
+			{
+				Description: "Write a Dockerfile into the job root.",
+				With: zbaction.ProcStepArgs{
+					"filename": "Dockerfile",
+					"content":  "FROM alpine\nCOPY . .",
+				},
+			},
+			{
+				Description: "Write an executable script which is kept for the later steps.",
+				With: zbaction.ProcStepArgs{
+					"filename":      "scripts/build.sh",
+					"content":       "#!/bin/sh\nmake build",
+					"mode":          "0755",
+					"createParents": "true",
+					"keep":          "true",
+				},
+			},
+			{
+				Description: "Render a configuration file from a template.",
+				With: zbaction.ProcStepArgs{
+					"filename": "config.json",
+					"content":  `{"version": "{{ output "version" "version" }}", "env": "{{ variable "ENV" }}"}`,
+					"template": "true",
+				},
+			},
+		},
+	}, func(args zbaction.ProcStepArgs) (zbaction.ProcedureStep, error) {
+		if mode := args["mode"]; !strings.Contains(mode, "$") {
+			if _, err := parseFileMode(mode); err != nil {
+				return nil, err
+			}
 		}
 
 		return &WriteAction{
-			Filename: zbaction.NewArgumentStr(filename),
-			Content:  zbaction.NewArgumentStr(args["content"]),
+			Filename:      zbaction.NewArgumentStr(args["filename"]),
+			Content:       zbaction.NewArgumentStr(args["content"]),
+			Mode:          zbaction.NewArgumentStr(args["mode"]),
+			CreateParents: zbaction.NewArgumentBool(args["createParents"]),
+			Append:        zbaction.NewArgumentBool(args["append"]),
+			Encoding:      zbaction.NewArgumentStr(args["encoding"]),
+			Template:      zbaction.NewArgumentBool(args["template"]),
+			Keep:          zbaction.NewArgumentBool(args["keep"]),
 		}, nil
 	})
 }
 
 type WriteAction struct {
-	Filename zbaction.Argument[string]
-	Content  zbaction.Argument[string]
+	Filename      zbaction.Argument[string]
+	Content       zbaction.Argument[string]
+	Mode          zbaction.Argument[string]
+	CreateParents zbaction.Argument[bool]
+	Append        zbaction.Argument[bool]
+	Encoding      zbaction.Argument[string]
+	Template      zbaction.Argument[bool]
+	Keep          zbaction.Argument[bool]
 }
 
 func (w *WriteAction) Run(_ context.Context, sc *zbaction.StepContext) (zbaction.CleanupFn, error) {
-	outFilePath := path.Join(sc.Root(), w.Filename.Value(sc.ExpandString))
-	err := os.WriteFile(outFilePath, []byte(w.Content.Value(sc.ExpandString)), 0644)
+	outFilePath, err := zbaction.ResolvePath(sc.Root(), w.Filename.Value(sc.ExpandString))
+	if err != nil {
+		return nil, err
+	}
+
+	mode, err := parseFileMode(w.Mode.Value(sc.ExpandString))
+	if err != nil {
+		return nil, err
+	}
+
+	content, err := w.content(sc)
+	if err != nil {
+		return nil, err
+	}
+
+	if w.CreateParents.Value(sc.ExpandString) {
+		if err := os.MkdirAll(filepath.Dir(outFilePath), 0o755); err != nil {
+			return nil, fmt.Errorf("create parent directories: %w", err)
+		}
+	}
+
+	appending := w.Append.Value(sc.ExpandString)
+
+	stat, err := os.Stat(outFilePath)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	}
+	exists := err == nil
+
+	// the size of the existing file, which the appended content is truncated to
+	originalSize := int64(-1)
+	if exists && appending {
+		originalSize = stat.Size()
+	}
+
+	flag := os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+	if appending {
+		flag = os.O_WRONLY | os.O_CREATE | os.O_APPEND
+	}
+
+	f, err := os.OpenFile(outFilePath, flag, mode)
 	if err != nil {
 		return nil, err
 	}
+	if _, err := f.Write(content); err != nil {
+		_ = f.Close()
+		return nil, err
+	}
+	if err := f.Close(); err != nil {
+		return nil, err
+	}
+	if !exists {
+		// the mode of OpenFile is masked by the umask
+		if err := os.Chmod(outFilePath, mode); err != nil {
+			return nil, err
+		}
+	}
 
 	sc.SetThisOutput("filepath", outFilePath)
 
+	if w.Keep.Value(sc.ExpandString) {
+		return nil, nil
+	}
+
 	return func() {
+		if originalSize >= 0 {
+			_ = os.Truncate(outFilePath, originalSize)
+			return
+		}
+
 		_ = os.Remove(outFilePath)
 	}, nil
 }
+
+// content gets the content to write, which is expanded
+// or rendered, and then decoded.
+func (w *WriteAction) content(sc *zbaction.StepContext) ([]byte, error) {
+	var content string
+
+	if w.Template.Value(sc.ExpandString) {
+		rendered, err := renderTemplate(sc, w.Content.Raw())
+		if err != nil {
+			return nil, err
+		}
+		content = rendered
+	} else {
+		content = w.Content.Value(sc.ExpandString)
+	}
+
+	switch encoding := WriteEncoding(w.Encoding.Value(sc.ExpandString)); encoding {
+	case WriteEncodingText, "":
+		return []byte(content), nil
+	case WriteEncodingBase64:
+		decoded, err := base64.StdEncoding.DecodeString(strings.TrimSpace(content))
+		if err != nil {
+			return nil, zbaction.NewErrInvalidArgument("content", "invalid base64: "+err.Error())
+		}
+		return decoded, nil
+	case WriteEncodingHex:
+		decoded, err := hex.DecodeString(strings.TrimSpace(content))
+		if err != nil {
+			return nil, zbaction.NewErrInvalidArgument("content", "invalid hex: "+err.Error())
+		}
+		return decoded, nil
+	default:
+		return nil, zbaction.NewErrInvalidArgument("encoding", "unknown encoding: "+string(encoding))
+	}
+}
+
+// renderTemplate renders text as a Go template with the variables and outputs of sc.
+func renderTemplate(sc *zbaction.StepContext, text string) (string, error) {
+	tmpl, err := template.New("content").Funcs(template.FuncMap{
+		"variable": func(key string) string {
+			value, _ := sc.VariableContainer().GetVariable(key)
+			return value
+		},
+		"output": func(id zbaction.StepID, key string) string {
+			value, ok := sc.GetOutput(id, key)
+			if !ok {
+				return ""
+			}
+			return fmt.Sprintf("%v", value)
+		},
+	}).Parse(text)
+	if err != nil {
+		return "", zbaction.NewErrInvalidArgument("content", "invalid template: "+err.Error())
+	}
+
+	rendered := &strings.Builder{}
+	if err := tmpl.Execute(rendered, nil); err != nil {
+		return "", fmt.Errorf("render template: %w", err)
+	}
+
+	return rendered.String(), nil
+}
+
+func parseFileMode(s string) (os.FileMode, error) {
+	mode, err := strconv.ParseUint(s, 8, 32)
+	if err != nil || mode > 0o777 {
+		return 0, zbaction.NewErrInvalidArgument("mode", "not an octal permission: "+s)
+	}
+
+	return os.FileMode(mode), nil
+}
@@ -0,0 +1,245 @@
+package procedures_test
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	zbaction "github.com/zeabur/action"
+)
+
+// snapshotStep reads the files in the job root in its cleanup,
+// which runs after the cleanups of the later steps.
+type snapshotStep struct {
+	files map[string]string
+}
+
+func (s snapshotStep) Run(_ context.Context, sc *zbaction.StepContext) (zbaction.CleanupFn, error) {
+	root := sc.Root()
+
+	return func() {
+		_ = filepath.WalkDir(root, func(path string, d os.DirEntry, err error) error {
+			if err != nil || d.IsDir() {
+				return err
+			}
+
+			content, err := os.ReadFile(path)
+			if err != nil {
+				return err
+			}
+			rel, _ := filepath.Rel(root, path)
+			s.files[filepath.ToSlash(rel)] = string(content)
+			return nil
+		})
+	}, nil
+}
+
+// runWrite runs the steps, and returns the stdout and
+// the files left in the job root after the cleanups of the steps.
+func runWrite(t *testing.T, steps ...zbaction.Step) (string, map[string]string, error) {
+	files := make(map[string]string)
+
+	r := zbaction.NewProcedureStepResolverWithParent(zbaction.GlobalProcedureResolver())
+	r.Register("test/snapshot", func(zbaction.ProcStepArgs) (zbaction.ProcedureStep, error) {
+		return snapshotStep{files: files}, nil
+	})
+
+	stdout := &bytes.Buffer{}
+	err := zbaction.RunAction(context.Background(), zbaction.Action{
+		Variables: map[string]string{"ENV": "production"},
+		Jobs: []zbaction.Job{
+			{
+				Steps: append([]zbaction.Step{
+					{RunnableStep: zbaction.ProcStep{Uses: "test/snapshot"}},
+				}, steps...),
+			},
+		},
+	}, zbaction.WithCustomStdout(stdout), zbaction.WithProcedureResolver(r))
+
+	return stdout.String(), files, err
+}
+
+func TestWrite(t *testing.T) {
+	stdout, files, err := runWrite(t,
+		zbaction.Step{
+			RunnableStep: zbaction.ProcStep{Uses: "action/write", With: zbaction.ProcStepArgs{
+				"filename": "Dockerfile",
+				"content":  "FROM ${ENV}",
+			}},
+		},
+		zbaction.Step{
+			RunnableStep: zbaction.CommandStep{Command: []string{"cat", "Dockerfile"}},
+		},
+	)
+
+	assert.NoError(t, err)
+	assert.Equal(t, "FROM production", stdout)
+	assert.Empty(t, files)
+}
+
+func TestWrite_KeepModeAndParents(t *testing.T) {
+	stdout, files, err := runWrite(t,
+		zbaction.Step{
+			RunnableStep: zbaction.ProcStep{Uses: "action/write", With: zbaction.ProcStepArgs{
+				"filename":      "scripts/build.sh",
+				"content":       "#!/bin/sh\necho built",
+				"mode":          "0750",
+				"createParents": "true",
+				"keep":          "true",
+			}},
+		},
+		zbaction.Step{
+			RunnableStep: zbaction.CommandStep{Command: []string{"stat", "-c", "%a", "scripts/build.sh"}},
+		},
+		zbaction.Step{
+			RunnableStep: zbaction.CommandStep{Command: []string{"./scripts/build.sh"}},
+		},
+	)
+
+	assert.NoError(t, err)
+	assert.Equal(t, "750\nbuilt\n", stdout)
+	assert.Equal(t, map[string]string{"scripts/build.sh": "#!/bin/sh\necho built"}, files)
+}
+
+func TestWrite_ModeIgnoresUmask(t *testing.T) {
+	oldUmask := syscall.Umask(0o022)
+	defer syscall.Umask(oldUmask)
+
+	stdout, _, err := runWrite(t,
+		zbaction.Step{
+			RunnableStep: zbaction.ProcStep{Uses: "action/write", With: zbaction.ProcStepArgs{
+				"filename": "shared.txt",
+				"content":  "shared",
+				"mode":     "0666",
+			}},
+		},
+		zbaction.Step{
+			RunnableStep: zbaction.CommandStep{Command: []string{"stat", "-c", "%a", "shared.txt"}},
+		},
+	)
+
+	assert.NoError(t, err)
+	assert.Equal(t, "666\n", stdout)
+}
+
+func TestWrite_NoParents(t *testing.T) {
+	_, _, err := runWrite(t, zbaction.Step{
+		RunnableStep: zbaction.ProcStep{Uses: "action/write", With: zbaction.ProcStepArgs{
+			"filename": "scripts/build.sh",
+		}},
+	})
+
+	assert.ErrorIs(t, err, os.ErrNotExist)
+}
+
+func TestWrite_Append(t *testing.T) {
+	stdout, files, err := runWrite(t,
+		zbaction.Step{
+			RunnableStep: zbaction.ProcStep{Uses: "action/write", With: zbaction.ProcStepArgs{
+				"filename": ".env",
+				"content":  "A=1\n",
+				"keep":     "true",
+			}},
+		},
+		zbaction.Step{
+			RunnableStep: zbaction.ProcStep{Uses: "action/write", With: zbaction.ProcStepArgs{
+				"filename": ".env",
+				"content":  "B=2\n",
+				"append":   "true",
+			}},
+		},
+		zbaction.Step{
+			RunnableStep: zbaction.CommandStep{Command: []string{"cat", ".env"}},
+		},
+	)
+
+	assert.NoError(t, err)
+	assert.Equal(t, "A=1\nB=2\n", stdout)
+	assert.Equal(t, map[string]string{".env": "A=1\n"}, files)
+}
+
+func TestWrite_Encoding(t *testing.T) {
+	stdout, _, err := runWrite(t,
+		zbaction.Step{
+			RunnableStep: zbaction.ProcStep{Uses: "action/write", With: zbaction.ProcStepArgs{
+				"filename": "base64",
+				"content":  "aGVsbG8K",
+				"encoding": "base64",
+			}},
+		},
+		zbaction.Step{
+			RunnableStep: zbaction.ProcStep{Uses: "action/write", With: zbaction.ProcStepArgs{
+				"filename": "hex",
+				"content":  "776f726c640a",
+				"encoding": "hex",
+			}},
+		},
+		zbaction.Step{
+			RunnableStep: zbaction.CommandStep{Command: []string{"cat", "base64", "hex"}},
+		},
+	)
+
+	assert.NoError(t, err)
+	assert.Equal(t, "hello\nworld\n", stdout)
+}
+
+func TestWrite_Template(t *testing.T) {
+	stdout, _, err := runWrite(t,
+		zbaction.Step{
+			ID:           "version",
+			RunnableStep: zbaction.ProcStep{Uses: "action/write", With: zbaction.ProcStepArgs{"filename": "version"}},
+		},
+		zbaction.Step{
+			RunnableStep: zbaction.ProcStep{Uses: "action/write", With: zbaction.ProcStepArgs{
+				"filename": "config",
+				"content":  `{{ $env := variable "ENV" }}{{ $env }} {{ base (output "version" "filepath") }} ${ENV}`,
+				"template": "true",
+			}},
+		},
+		zbaction.Step{
+			RunnableStep: zbaction.CommandStep{Command: []string{"cat", "config"}},
+		},
+	)
+
+	assert.ErrorContains(t, err, "invalid template")
+	assert.Empty(t, stdout)
+
+	stdout, _, err = runWrite(t,
+		zbaction.Step{
+			ID:           "version",
+			RunnableStep: zbaction.ProcStep{Uses: "action/write", With: zbaction.ProcStepArgs{"filename": "version"}},
+		},
+		zbaction.Step{
+			RunnableStep: zbaction.ProcStep{Uses: "action/write", With: zbaction.ProcStepArgs{
+				"filename": "config",
+				"content":  `{{ $env := variable "ENV" }}{{ $env }} {{ output "version" "filepath" | printf "%.1s" }} ${ENV}`,
+				"template": "true",
+			}},
+		},
+		zbaction.Step{
+			RunnableStep: zbaction.CommandStep{Command: []string{"cat", "config"}},
+		},
+	)
+
+	assert.NoError(t, err)
+	assert.Equal(t, "production / ${ENV}", stdout)
+}
+
+func TestWrite_InvalidArguments(t *testing.T) {
+	for _, with := range []zbaction.ProcStepArgs{
+		{"filename": "a", "mode": "rw-r--r--"},
+		{"filename": "a", "mode": "01000"},
+		{"filename": "a", "encoding": "base64", "content": "!"},
+		{"filename": "../a"},
+	} {
+		_, _, err := runWrite(t, zbaction.Step{
+			RunnableStep: zbaction.ProcStep{Uses: "action/write", With: with},
+		})
+
+		assert.Error(t, err, with)
+	}
+}
@@ -0,0 +1,20 @@
+//go:build !unix
+
+package zbaction
+
+import (
+	"os/exec"
+	"time"
+)
+
+// processGroup falls back to killing the direct child
+// on the platforms without process groups.
+type processGroup struct{}
+
+func newProcessGroup(cmd *exec.Cmd, gracePeriod time.Duration) *processGroup {
+	cmd.WaitDelay = gracePeriod
+
+	return &processGroup{}
+}
+
+func (g *processGroup) Wait() {}
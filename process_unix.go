@@ -0,0 +1,102 @@
+//go:build unix
+
+package zbaction
+
+import (
+	"errors"
+	"os/exec"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// processGroup runs a command in its own process group,
+// so we can signal the command with all its descendants.
+type processGroup struct {
+	cmd         *exec.Cmd
+	gracePeriod time.Duration
+
+	terminatedAt time.Time
+	// killTimer sends SIGKILL after the grace period.
+	// It is stopped once the group has exited, so it will not
+	// signal another group reusing the process group ID.
+	killTimer *time.Timer
+	mu        sync.Mutex
+}
+
+// newProcessGroup configures cmd to run in a new process group.
+//
+// When the context of cmd is done, the whole group receives SIGTERM,
+// and then SIGKILL if it has not exited after gracePeriod.
+func newProcessGroup(cmd *exec.Cmd, gracePeriod time.Duration) *processGroup {
+	g := &processGroup{
+		cmd:         cmd,
+		gracePeriod: gracePeriod,
+	}
+
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	cmd.Cancel = g.terminate
+	// Close the pipes even if some processes escaped
+	// from the group and are holding them. If the command
+	// exited successfully, Wait returns exec.ErrWaitDelay then.
+	cmd.WaitDelay = gracePeriod + processGroupKillTimeout
+
+	return g
+}
+
+// processGroupKillTimeout is the time to wait for a group to exit after SIGKILL.
+const processGroupKillTimeout = 5 * time.Second
+
+func (g *processGroup) terminate() error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	g.terminatedAt = time.Now()
+
+	err := syscall.Kill(-g.cmd.Process.Pid, syscall.SIGTERM)
+	if errors.Is(err, syscall.ESRCH) {
+		return nil
+	}
+
+	g.killTimer = time.AfterFunc(g.gracePeriod, g.kill)
+
+	return err
+}
+
+func (g *processGroup) kill() {
+	_ = syscall.Kill(-g.cmd.Process.Pid, syscall.SIGKILL)
+}
+
+// alive reports whether any process in the group is still running.
+func (g *processGroup) alive() bool {
+	return syscall.Kill(-g.cmd.Process.Pid, 0) == nil
+}
+
+// Wait waits for the processes remaining in a terminated group to exit.
+//
+// It should be called after cmd has exited. It returns immediately
+// if the group has not been terminated.
+func (g *processGroup) Wait() {
+	g.mu.Lock()
+	terminatedAt := g.terminatedAt
+	killTimer := g.killTimer
+	g.mu.Unlock()
+
+	if terminatedAt.IsZero() || g.cmd.Process == nil {
+		return
+	}
+	if killTimer != nil {
+		defer killTimer.Stop()
+	}
+
+	killAt := terminatedAt.Add(g.gracePeriod)
+	deadline := killAt.Add(processGroupKillTimeout)
+
+	for g.alive() && time.Now().Before(deadline) {
+		if time.Now().After(killAt) {
+			g.kill()
+		}
+
+		time.Sleep(50 * time.Millisecond)
+	}
+}
@@ -0,0 +1,63 @@
+package zbaction
+
+// ActionResult is the result of running an action.
+type ActionResult struct {
+	ID   ActionID
+	Jobs []JobResult
+}
+
+// JobResult is the result of running a job.
+type JobResult struct {
+	ID JobID
+	// Steps are the steps which have run, in order.
+	Steps []StepResult
+}
+
+// StepResult is the result of running a step.
+type StepResult struct {
+	ID      StepID
+	Name    string
+	Outputs StepOutput
+	// Error is the error message if the step failed.
+	Error string
+	// Action is the result of the nested action run by an ActionStep.
+	Action *ActionResult
+	// Annotations are the annotations raised by the step and the steps nested in it.
+	Annotations []Annotation
+	// Summary is the Markdown summary of the step and the steps nested in it.
+	Summary string
+}
+
+// GetOutput gets the output of a step, looking up the jobs in order.
+func (r ActionResult) GetOutput(id StepID, key string) (any, bool) {
+	for _, job := range r.Jobs {
+		for _, step := range job.Steps {
+			if step.ID != id {
+				continue
+			}
+
+			if value, ok := step.Outputs[key]; ok {
+				return value, true
+			}
+		}
+	}
+
+	return nil, false
+}
+
+// Annotations gets the annotations of all the steps in order,
+// including the steps of the nested actions.
+func (r ActionResult) Annotations() []Annotation {
+	var annotations []Annotation
+
+	for _, job := range r.Jobs {
+		for _, step := range job.Steps {
+			annotations = append(annotations, step.Annotations...)
+			if step.Action != nil {
+				annotations = append(annotations, step.Action.Annotations()...)
+			}
+		}
+	}
+
+	return annotations
+}
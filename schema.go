@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"strings"
+	"time"
 
 	"github.com/mitchellh/hashstructure/v2"
 )
@@ -21,6 +22,7 @@ type Action struct {
 	Jobs         []Job
 	Requirements []Requirement
 	Metadata     map[string]string
+	Defaults     Defaults
 }
 
 func (a Action) String() string {
@@ -58,6 +60,9 @@ type Job struct {
 	ID        JobID
 	Variables map[string]string
 	Steps     []Step
+	Defaults  Defaults
+	// Limits are the resource limits of each command step in this job.
+	Limits ResourceLimits
 }
 
 func (j Job) String() string {
@@ -73,10 +78,72 @@ func (j Job) String() string {
 	return "<unknown job>"
 }
 
+// Defaults are the default settings of the steps in an action or a job.
+//
+// The defaults of a job take precedence over the defaults of its action.
+type Defaults struct {
+	// WorkingDirectory is the default working directory of the steps,
+	// relative to the job root.
+	WorkingDirectory string
+	// Shell is the default shell to run the commands with, for example
+	// `[]string{"bash", "-c"}`. The command must be a single script,
+	// which is passed to the shell as the last argument.
+	//
+	// If it is empty, the command is executed directly.
+	Shell []string
+	// Environment is the default environment variables of the commands.
+	//
+	// Variables of the action, job and step take precedence over them.
+	Environment map[string]string
+	// InactivityTimeout is the default inactivity timeout of the steps.
+	InactivityTimeout time.Duration
+}
+
+// Override returns a copy of d overridden by the non-empty settings in o.
+func (d Defaults) Override(o Defaults) Defaults {
+	merged := Defaults{
+		WorkingDirectory:  d.WorkingDirectory,
+		Shell:             d.Shell,
+		Environment:       make(map[string]string, len(d.Environment)+len(o.Environment)),
+		InactivityTimeout: d.InactivityTimeout,
+	}
+
+	if o.WorkingDirectory != "" {
+		merged.WorkingDirectory = o.WorkingDirectory
+	}
+	if len(o.Shell) > 0 {
+		merged.Shell = o.Shell
+	}
+	if o.InactivityTimeout > 0 {
+		merged.InactivityTimeout = o.InactivityTimeout
+	}
+	for k, v := range d.Environment {
+		merged.Environment[k] = v
+	}
+	for k, v := range o.Environment {
+		merged.Environment[k] = v
+	}
+
+	return merged
+}
+
+func (d Defaults) IsZero() bool {
+	return d.WorkingDirectory == "" && len(d.Shell) == 0 && len(d.Environment) == 0 && d.InactivityTimeout == 0
+}
+
 type Step struct {
 	ID        StepID
 	Name      string
 	Variables map[string]string
+	// WorkingDirectory is the directory to run this step in,
+	// relative to the job root. It must not escape the job root.
+	WorkingDirectory string
+	// Limits are the resource limits of this step if it is a command step.
+	// They can only narrow the limits of the job.
+	Limits ResourceLimits
+	// InactivityTimeout cancels this step if it writes nothing
+	// to stdout and stderr for the duration. Zero means no timeout.
+	InactivityTimeout time.Duration
 	RunnableStep
 }
 
@@ -111,7 +178,7 @@ type ProcStep struct {
 }
 
 func (p ProcStep) Run(ctx context.Context, sc *StepContext) (CleanupFn, error) {
-	step, err := ResolveProcedure(p.Uses, p.With)
+	step, err := sc.ProcedureResolver().Resolve(p.Uses, p.With)
 	if err != nil {
 		return nil, err
 	}
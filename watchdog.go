@@ -0,0 +1,67 @@
+package zbaction
+
+import (
+	"io"
+	"sync/atomic"
+	"time"
+)
+
+// inactivityWatchdog calls onTimeout if it has not been touched for timeout.
+type inactivityWatchdog struct {
+	timeout   time.Duration
+	onTimeout func()
+
+	lastActivity atomic.Int64
+	timer        *time.Timer
+}
+
+func newInactivityWatchdog(timeout time.Duration, onTimeout func()) *inactivityWatchdog {
+	w := &inactivityWatchdog{
+		timeout:   timeout,
+		onTimeout: onTimeout,
+	}
+	w.Touch()
+	w.timer = time.AfterFunc(timeout, w.check)
+
+	return w
+}
+
+// Touch records an activity.
+func (w *inactivityWatchdog) Touch() {
+	w.lastActivity.Store(time.Now().UnixNano())
+}
+
+func (w *inactivityWatchdog) check() {
+	idle := time.Since(time.Unix(0, w.lastActivity.Load()))
+	if idle < w.timeout {
+		w.timer.Reset(w.timeout - idle)
+		return
+	}
+
+	w.onTimeout()
+}
+
+// Stop stops the watchdog. onTimeout will not be called after Stop returns,
+// unless it has been called.
+func (w *inactivityWatchdog) Stop() {
+	w.timer.Stop()
+}
+
+// Writer wraps target so that writing to it touches the watchdog.
+func (w *inactivityWatchdog) Writer(target io.Writer) io.Writer {
+	return &watchdogWriter{
+		Writer:   target,
+		watchdog: w,
+	}
+}
+
+type watchdogWriter struct {
+	io.Writer
+
+	watchdog *inactivityWatchdog
+}
+
+func (w *watchdogWriter) Write(p []byte) (int, error) {
+	w.watchdog.Touch()
+	return w.Writer.Write(p)
+}